@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// big reports whether the box takes more than half of the pallet each way,
+// whichever way around it fits. No two big boxes can share a layer.
+func (b box) big(size palletSize) bool {
+	if !size.holds(b) {
+		return false
+	}
+	// A way around that doesn't fit doesn't count.
+	half := func(w, l uint8) bool {
+		return !size.fits(w, l) || 2*int(w) > int(size.l) && 2*int(l) > int(size.w)
+	}
+	if b.locked {
+		return half(b.w, b.l)
+	}
+	return half(b.w, b.l) && half(b.l, b.w)
+}
+
+// A palletBound is the fewest pallets some boxes could need, found two ways.
+type palletBound struct {
+	// area is how many pallets the volume of the boxes fills.
+	area int
+	// big is how many pallets it takes to give each big box its own layers.
+	big int
+}
+
+// pallets returns the bound.
+func (b palletBound) pallets() int {
+	if b.big > b.area {
+		return b.big
+	}
+	return b.area
+}
+
+// boundFor returns a bound for boxes with the given volume, and big boxes
+// with the given total height, on pallets of the given size.
+func boundFor(size palletSize, volume, bigHeight int) palletBound {
+	v, h := size.volume(), size.height()
+	return palletBound{
+		area: (volume + v - 1) / v,
+		big:  (bigHeight + h - 1) / h,
+	}
+}
+
+// boundPallets returns a bound on the pallets the boxes need. Boxes too big
+// for the pallet aren't counted.
+func boundPallets(size palletSize, boxes []box) palletBound {
+	volume, bigHeight := 0, 0
+	for _, b := range boxes {
+		if !size.holds(b) {
+			continue
+		}
+		volume += b.volume()
+		if b.big(size) {
+			bigHeight += b.height()
+		}
+	}
+	return boundFor(size, volume, bigHeight)
+}
+
+// truckBoxes returns the boxes on all of the truck's pallets.
+func truckBoxes(t *truck) []box {
+	var boxes []box
+	for _, p := range t.pallets {
+		boxes = append(boxes, p.boxes...)
+	}
+	return boxes
+}
+
+// A boxesBound collects what is needed for a bound over the boxes of many
+// trucks, which can only be worked out once the last truck's pallet size is
+// known.
+type boxesBound struct {
+	volume int
+	// bigBoxes are the boxes that are big on their own truck's pallets.
+	// Other boxes aren't counted as big even if they are on the last
+	// truck's pallets, which can only make the bound lower.
+	bigBoxes []box
+}
+
+// add counts boxes that are on pallets of the given size.
+func (bb *boxesBound) add(size palletSize, boxes []box) {
+	for _, b := range boxes {
+		bb.volume += b.volume()
+		if b.big(size) {
+			bb.bigBoxes = append(bb.bigBoxes, b.canon())
+		}
+	}
+}
+
+// bound returns the bound for all of the boxes, on pallets of the given
+// size.
+func (bb *boxesBound) bound(size palletSize) palletBound {
+	bigHeight := 0
+	for _, b := range bb.bigBoxes {
+		if b.big(size) {
+			bigHeight += b.height()
+		}
+	}
+	return boundFor(size, bb.volume, bigHeight)
+}
+
+// A truckGap is how far a truck's pallets are from the bound for the boxes
+// it left with.
+type truckGap struct {
+	id, pallets, bound int
+}
+
+// writeGaps writes how many pallets each truck left with against the fewest
+// its boxes could need.
+func writeGaps(w io.Writer, gaps []truckGap) error {
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i].id < gaps[j].id })
+	for _, g := range gaps {
+		if _, err := fmt.Fprintf(w, "truck %d: %d pallets, at least %d, gap %d\n", g.id, g.pallets, g.bound, g.pallets-g.bound); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTotalGaps writes how many pallets the repacked trucks left with
+// against the fewest the boxes they shipped could need, and against the
+// fewest all of the input could need. Boxes that were never delivered make
+// the second gap smaller, or negative.
+func writeTotalGaps(w io.Writer, pallets int, shipped, input palletBound) error {
+	for _, g := range []struct {
+		what  string
+		bound palletBound
+	}{
+		{"shipped boxes", shipped},
+		{"all input boxes", input},
+	} {
+		if _, err := fmt.Fprintf(w, "pallets: %d, %s need at least %d (area %d, big boxes %d), gap %d\n",
+			pallets, g.what, g.bound.pallets(), g.bound.area, g.bound.big, pallets-g.bound.pallets()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_box_big(t *testing.T) {
+	size := palletSize{w: 4, l: 6}
+	cases := []struct {
+		b    box
+		want bool
+	}{
+		// Turned, two fit side by side along the 6.
+		{box{w: 4, l: 3}, false},
+		{box{w: 3, l: 4}, false},
+		{box{w: 3, l: 3}, false},
+		{box{w: 4, l: 2}, false},
+		{box{w: 5, l: 3}, true},
+		{box{w: 6, l: 4}, true},
+		{box{w: 4, l: 4}, true},
+		{box{w: 7, l: 4}, false},
+		// Unless it can't be turned.
+		{box{w: 4, l: 3, locked: true}, true},
+	}
+	for _, c := range cases {
+		if got := c.b.big(size); got != c.want {
+			t.Errorf("%v: big %v, want %v", c.b, got, c.want)
+		}
+	}
+}
+
+func Test_boundPallets(t *testing.T) {
+	size := palletSize{w: 4, l: 4}
+	// Three 3x3 boxes can't share, even though they'd fit by area on two
+	// pallets.
+	boxes := []box{{w: 3, l: 3}, {w: 3, l: 3}, {w: 3, l: 3}, {w: 1, l: 1}}
+	b := boundPallets(size, boxes)
+	if b.area != 2 || b.big != 3 || b.pallets() != 3 {
+		t.Errorf("bound %+v", b)
+	}
+
+	// Stacked two high, they take two pallets.
+	size.h = 2
+	if b := boundPallets(size, boxes); b.pallets() != 2 {
+		t.Errorf("stacked bound %+v", b)
+	}
+
+	// Lots of small boxes need pallets by area.
+	var small []box
+	for i := 0; i < 33; i++ {
+		small = append(small, box{w: 1, l: 1})
+	}
+	if b := boundPallets(palletSize{w: 4, l: 4}, small); b.area != 3 || b.big != 0 {
+		t.Errorf("small bound %+v", b)
+	}
+}
+
+func Test_boxesBound(t *testing.T) {
+	var bb boxesBound
+	small := &truck{id: 1, pallets: []pallet{
+		{boxes: []box{{w: 2, l: 2, id: 1}}},
+		{boxes: []box{{w: 2, l: 2, id: 2}}},
+	}}
+	if b := boundPallets(palletSize{w: 2, l: 2}, truckBoxes(small)); b.pallets() != 2 {
+		t.Errorf("truck 1 bound %+v", b)
+	}
+	bb.add(palletSize{w: 2, l: 2}, truckBoxes(small))
+	large := &truck{id: 2, pallets: []pallet{
+		{boxes: []box{{w: 2, l: 2, id: 3}}},
+	}}
+	bb.add(palletSize{w: 4, l: 4}, truckBoxes(large))
+	// On 4x4 pallets the 2x2 boxes aren't big, and all three fit on one.
+	if b := bb.bound(palletSize{w: 4, l: 4}); b.pallets() != 1 || b.big != 0 {
+		t.Errorf("bound %+v", b)
+	}
+}
+
+func Test_writeGaps(t *testing.T) {
+	var buf bytes.Buffer
+	gaps := []truckGap{{id: 2, pallets: 1, bound: 1}, {id: 1, pallets: 3, bound: 2}}
+	if err := writeGaps(&buf, gaps); err != nil {
+		t.Fatal(err)
+	}
+	want := "truck 1: 3 pallets, at least 2, gap 1\ntruck 2: 1 pallets, at least 1, gap 0\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Boxes that weren't delivered make the gap against the input
+	// negative.
+	buf.Reset()
+	if err := writeTotalGaps(&buf, 4, palletBound{area: 3, big: 1}, palletBound{area: 6}); err != nil {
+		t.Fatal(err)
+	}
+	want = "pallets: 4, shipped boxes need at least 3 (area 3, big boxes 1), gap 1\n" +
+		"pallets: 4, all input boxes need at least 6 (area 6, big boxes 0), gap -2\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
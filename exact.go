@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Limits of the exact solver. Pallets with more cells, or boxes with more
+// different sizes, are packed with MaxRects instead. The number of states
+// grows so fast with the cells that a 6x6 pallet can take seconds.
+const (
+	// A 5x5 pallet: with up to 30 random boxes of 1x1 to 3x3 it took at
+	// most about 150ms, where the next square up, 6x6, can take seconds.
+	maxExactCells  = 25
+	maxExactShapes = 16
+)
+
+// cellMask has one bit per cell of a pallet, x major.
+type cellMask uint64
+
+// exactGoal decides what the exact solver maximizes.
+type exactGoal int
+
+const (
+	// Cover as many cells as possible, with as few boxes as possible so that
+	// small boxes are left to fill gaps on later pallets.
+	exactMostCells exactGoal = iota
+	// Use as many boxes as possible, then cover as many cells as possible.
+	exactMostBoxes
+)
+
+// exactState is the memo key of the exact solver: the cells that are covered
+// (or given up on), and how many boxes of each shape have been used.
+type exactState struct {
+	mask cellMask
+	used [maxExactShapes]uint8
+}
+
+// exactSolver finds the best packing of one pallet by searching every
+// placement. A 4x4 pallet has 16 cells, so its occupancy fits in a uint16
+// (and anything up to maxExactCells fits in a cellMask), and results are
+// memoized by that mask.
+type exactSolver struct {
+	goal   exactGoal
+	size   palletSize
+	full   cellMask
+	shapes []box
+	done   <-chan struct{}
+	calls  int
+	// stopped is set once done is closed. Scores found after that are
+	// wrong, and aren't memoized.
+	stopped bool
+	avail   [maxExactShapes]uint8
+	memo    map[exactState]int
+	// masks[s][o][c] is the mask covered by shape s, in orientation o,
+	// with its first cell at c, or 0 if it does not fit there.
+	masks [][2][]cellMask
+}
+
+// newExactSolver prepares a solver for a pallet of the given size, and the
+// shapes available. Shapes are canonical (w >= l unless they are locked),
+// sorted smallest first. Locked shapes are only tried the way they are.
+func newExactSolver(goal exactGoal, size palletSize, shapes []box, avail [maxExactShapes]uint8) *exactSolver {
+	s := &exactSolver{
+		goal:   goal,
+		size:   size,
+		full:   cellMask(1)<<uint(size.cells()) - 1,
+		shapes: shapes,
+		avail:  avail,
+		memo:   make(map[exactState]int),
+		masks:  make([][2][]cellMask, len(shapes)),
+	}
+	for si, sh := range shapes {
+		for o, dim := range [2][2]uint8{{sh.w, sh.l}, {sh.l, sh.w}} {
+			if o == 1 && (sh.w == sh.l || sh.locked) {
+				continue
+			}
+			w, l := int(dim[0]), int(dim[1])
+			s.masks[si][o] = make([]cellMask, size.cells())
+			for c := range s.masks[si][o] {
+				x, y := c/int(size.l), c%int(size.l)
+				if x+l > int(size.w) || y+w > int(size.l) {
+					continue
+				}
+				var m cellMask
+				for i := x; i < x+l; i++ {
+					for j := y; j < y+w; j++ {
+						m |= 1 << uint(i*int(size.l)+j)
+					}
+				}
+				s.masks[si][o][c] = m
+			}
+		}
+	}
+	return s
+}
+
+// value combines cells and boxes into one score according to the goal.
+func (s *exactSolver) value(cells, boxes int) int {
+	if s.goal == exactMostBoxes {
+		return boxes*(s.size.cells()+1) + cells
+	}
+	return cells*(s.size.cells()+1) - boxes
+}
+
+// best returns the best score that can be added from state st.
+func (s *exactSolver) best(st exactState) int {
+	if st.mask == s.full {
+		return 0
+	}
+	if v, ok := s.memo[st]; ok {
+		return v
+	}
+	if s.cancelled() {
+		return 0
+	}
+	c := s.firstEmpty(st.mask)
+	bound := s.bound(st)
+
+	// Put a box there, biggest first, since that usually finds the best
+	// score quickly.
+	v := 0
+	for si := len(s.shapes) - 1; si >= 0 && v < bound; si-- {
+		if st.used[si] >= s.avail[si] {
+			continue
+		}
+		sh := s.shapes[si]
+		for o := range s.masks[si] {
+			if s.masks[si][o] == nil {
+				continue
+			}
+			m := s.masks[si][o][c]
+			if m == 0 || m&st.mask != 0 {
+				continue
+			}
+			if n := s.value(int(sh.w)*int(sh.l), 1) + s.best(s.next(st, si, m)); n > v {
+				v = n
+			}
+		}
+	}
+
+	// Or leave the cell empty.
+	if v < bound {
+		bit := cellMask(1) << uint(c)
+		if n := s.best(exactState{st.mask | bit, st.used}); n > v {
+			v = n
+		}
+	}
+	if !s.stopped {
+		s.memo[st] = v
+	}
+	return v
+}
+
+// cancelled checks every so often whether the search should stop.
+func (s *exactSolver) cancelled() bool {
+	if s.stopped || s.done == nil {
+		return s.stopped
+	}
+	if s.calls++; s.calls%1024 == 0 {
+		select {
+		case <-s.done:
+			s.stopped = true
+		default:
+		}
+	}
+	return s.stopped
+}
+
+// next returns the state after placing shape si over mask m. Shapes that are
+// so plentiful that they can never run out aren't counted, which keeps the
+// number of states down.
+func (s *exactSolver) next(st exactState, si int, m cellMask) exactState {
+	st.mask |= m
+	if s.avail[si] < s.shapes[si].unlimited(s.size) {
+		st.used[si]++
+	}
+	return st
+}
+
+// bound returns a score that can't be beaten from state st: every empty cell
+// is covered, limited by the area of the boxes that are left.
+func (s *exactSolver) bound(st exactState) int {
+	empty := s.size.cells() - popcount(st.mask)
+	if s.goal == exactMostBoxes {
+		return s.value(empty, empty)
+	}
+	area := 0
+	for si, sh := range s.shapes {
+		if area >= empty {
+			break
+		}
+		area += int(s.avail[si]-st.used[si]) * int(sh.w) * int(sh.l)
+	}
+	if area < empty {
+		empty = area
+	}
+	if empty == 0 {
+		return 0
+	}
+	return s.value(empty, 1)
+}
+
+// unlimited is how many boxes of this size fill a pallet.
+func (b box) unlimited(size palletSize) uint8 {
+	n := size.cells() / (int(b.w) * int(b.l))
+	if n > 255 {
+		n = 255
+	}
+	return uint8(n)
+}
+
+// popcount returns the number of bits set.
+func popcount(m cellMask) (n int) {
+	for ; m != 0; m &= m - 1 {
+		n++
+	}
+	return
+}
+
+// firstEmpty returns the index of the lowest cell that is not set.
+func (s *exactSolver) firstEmpty(mask cellMask) int {
+	for c := 0; c < s.size.cells(); c++ {
+		if mask&(1<<uint(c)) == 0 {
+			return c
+		}
+	}
+	return -1
+}
+
+// placements walks the memo from the empty pallet and returns the shape and
+// mask of each box in the best packing.
+func (s *exactSolver) placements() (shapes []int, masks []cellMask) {
+	st := exactState{}
+	for st.mask != s.full {
+		want := s.best(st)
+		c := s.firstEmpty(st.mask)
+		found := false
+		for si := len(s.shapes) - 1; si >= 0; si-- {
+			if st.used[si] >= s.avail[si] {
+				continue
+			}
+			sh := s.shapes[si]
+			for o := range s.masks[si] {
+				if s.masks[si][o] == nil {
+					continue
+				}
+				m := s.masks[si][o][c]
+				if m == 0 || m&st.mask != 0 {
+					continue
+				}
+				next := s.next(st, si, m)
+				if s.value(int(sh.w)*int(sh.l), 1)+s.best(next) == want {
+					shapes = append(shapes, si)
+					masks = append(masks, m)
+					st = next
+					found = true
+					break
+				}
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			st.mask |= 1 << uint(c)
+		}
+	}
+	return
+}
+
+// exactShapes returns the canonical sizes (w >= l unless locked) of the boxes
+// that fit on the pallet, smallest first.
+func exactShapes(size palletSize, boxes []box) []box {
+	seen := make(map[box]bool)
+	var shapes []box
+	for _, b := range boxes {
+		c := box{w: b.w, l: b.l, locked: b.locked}.canon()
+		if seen[c] || !size.holds(c) {
+			continue
+		}
+		seen[c] = true
+		shapes = append(shapes, c)
+	}
+	sort.Stable(sort.Reverse(byArea(shapes)))
+	return shapes
+}
+
+// shapeIndex returns the index in shapes of the box's size, or -1 if it is
+// not there.
+func shapeIndex(shapes []box, b box) int {
+	c := b.canon()
+	for i, sh := range shapes {
+		if sh.w == c.w && sh.l == c.l && sh.locked == c.locked {
+			return i
+		}
+	}
+	return -1
+}
+
+// exactPacker is a Packer that uses the exact solver with a goal.
+type exactPacker exactGoal
+
+// Pack implements Packer.
+func (e exactPacker) Pack(pal *pallet, boxes []box) []box {
+	return packExactUntil(nil, pal, boxes, exactGoal(e))
+}
+
+// PackUntil implements cancelPacker.
+func (e exactPacker) PackUntil(done <-chan struct{}, pal *pallet, boxes []box) []box {
+	return packExactUntil(done, pal, boxes, exactGoal(e))
+}
+
+// packExact fills a pallet with the most cells that can be covered by the
+// boxes given. It returns the boxes that were not put onto the pallet.
+func packExact(pal *pallet, boxes []box) []box {
+	return packExactGoal(pal, boxes, exactMostCells)
+}
+
+// packExactGoal fills a pallet optimally for the goal.
+func packExactGoal(pal *pallet, boxes []box, goal exactGoal) []box {
+	return packExactUntil(nil, pal, boxes, goal)
+}
+
+// packExactUntil fills a pallet optimally for the goal, unless done is
+// closed first, in which case it packs with MaxRects instead. Boxes of the
+// same size are interchangeable, so the search only tracks how many of each
+// are used, and boxes earlier in the slice are used first.
+func packExactUntil(done <-chan struct{}, pal *pallet, boxes []box, goal exactGoal) []box {
+	size := pal.dims()
+	shapes := exactShapes(size, boxes)
+	if size.cells() > maxExactCells || len(shapes) > maxExactShapes {
+		return packWithMaxRects(pal, boxes)
+	}
+
+	var avail [maxExactShapes]uint8
+	for _, b := range boxes {
+		if si := shapeIndex(shapes, b); si >= 0 && avail[si] < shapes[si].unlimited(size) {
+			avail[si]++
+		}
+	}
+
+	s := newExactSolver(goal, size, shapes, avail)
+	s.done = done
+	placed, masks := s.placements()
+	if debug {
+		fmt.Printf("  exact: %d boxes, %d states\n", len(placed), len(s.memo))
+	}
+	if s.stopped {
+		return packWithMaxRects(pal, boxes)
+	}
+
+	used := make(map[uint32]bool)
+	for i, si := range placed {
+		for _, b := range boxes {
+			if used[b.id] || shapeIndex(shapes, b) != si {
+				continue
+			}
+			used[b.id] = true
+			pal.boxes = append(pal.boxes, boxFromMask(size, b, masks[i]))
+			break
+		}
+	}
+
+	unusedBoxes := make([]box, 0, len(boxes))
+	for _, b := range boxes {
+		if !used[b.id] {
+			unusedBoxes = append(unusedBoxes, b)
+		}
+	}
+	return unusedBoxes
+}
+
+// boxFromMask positions the box to cover the cells in mask.
+func boxFromMask(size palletSize, b box, m cellMask) box {
+	first, last := -1, 0
+	for c := 0; c < size.cells(); c++ {
+		if m&(1<<uint(c)) != 0 {
+			if first < 0 {
+				first = c
+			}
+			last = c
+		}
+	}
+	l := int(size.l)
+	b.x, b.y = uint8(first/l), uint8(first%l)
+	b.l = uint8(last/l) - b.x + 1
+	b.w = uint8(last%l) - b.y + 1
+	return b
+}
@@ -0,0 +1,67 @@
+package main
+
+import "testing"
+
+func Test_boxFromMask(t *testing.T) {
+	b := boxFromMask(palletSize{w: 4, l: 4}, box{x: 0, y: 0, w: 9, l: 9, id: 99}, 0x0660)
+	if want := (box{x: 1, y: 1, w: 2, l: 2, id: 99}); b != want {
+		t.Errorf("got %v, want %v", b, want)
+	}
+}
+
+func Test_packExact(t *testing.T) {
+	tests := []struct {
+		goal   exactGoal
+		boxes  []box
+		placed int
+		cells  int
+	}{
+		{
+			// The big box covers the most, the small ones are the most.
+			goal:   exactMostCells,
+			boxes:  []box{{x: 0, y: 0, w: 1, l: 1, id: 90}, {x: 0, y: 0, w: 1, l: 1, id: 91}, {x: 0, y: 0, w: 4, l: 4, id: 92}},
+			placed: 1,
+			cells:  16,
+		},
+		{
+			goal:   exactMostBoxes,
+			boxes:  []box{{x: 0, y: 0, w: 1, l: 1, id: 90}, {x: 0, y: 0, w: 1, l: 1, id: 91}, {x: 0, y: 0, w: 4, l: 4, id: 92}},
+			placed: 2,
+			cells:  2,
+		},
+		{
+			// A tiling that the shelf packer misses.
+			goal:   exactMostCells,
+			boxes:  []box{{x: 0, y: 0, w: 3, l: 1, id: 90}, {x: 0, y: 0, w: 1, l: 3, id: 91}, {x: 0, y: 0, w: 3, l: 3, id: 92}, {x: 0, y: 0, w: 1, l: 1, id: 93}, {x: 0, y: 0, w: 5, l: 5, id: 94}},
+			placed: 4,
+			cells:  16,
+		},
+		{
+			// Five 2x3 boxes: only two fit.
+			goal:   exactMostCells,
+			boxes:  []box{{x: 0, y: 0, w: 2, l: 3, id: 90}, {x: 0, y: 0, w: 3, l: 2, id: 91}, {x: 0, y: 0, w: 2, l: 3, id: 92}, {x: 0, y: 0, w: 2, l: 3, id: 93}, {x: 0, y: 0, w: 2, l: 3, id: 94}},
+			placed: 2,
+			cells:  12,
+		},
+	}
+	for i, test := range tests {
+		pal := &pallet{}
+		unused := packExactGoal(pal, test.boxes, test.goal)
+		if err := pal.IsValid(); err != nil {
+			t.Errorf("%d: pallet is not packed correctly: %s", i, err)
+		}
+		if got, want := len(pal.boxes), test.placed; got != want {
+			t.Errorf("%d: placed %d boxes, want %d%s", i, got, want, pal)
+		}
+		if got, want := len(pal.boxes)+len(unused), len(test.boxes); got != want {
+			t.Errorf("%d: got %d boxes back, want %d", i, got, want)
+		}
+		cells := 0
+		for _, b := range pal.boxes {
+			cells += int(b.w) * int(b.l)
+		}
+		if cells != test.cells {
+			t.Errorf("%d: covered %d cells, want %d", i, cells, test.cells)
+		}
+	}
+}
@@ -1,50 +1,290 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-func generate(n, seed int) {
-	rand.Seed(int64(seed))
+// A dist picks numbers at random for the generator.
+type dist interface {
+	pick(rng *rand.Rand) int
+	// all reports whether ok is true for every number it can pick.
+	all(ok func(int) bool) bool
+}
 
-	for i := 0; i < n; i++ {
-		t := gentruck()
+// uniformDist picks from low to high, inclusive, all equally likely.
+type uniformDist struct {
+	low, high int
+}
 
-		fmt.Println("truck", t.id)
-		for _, p := range t.pallets {
-			fmt.Println(p.OneLine())
+func (d uniformDist) pick(rng *rand.Rand) int {
+	return rng.Intn(d.high-d.low+1) + d.low
+}
+
+func (d uniformDist) all(ok func(int) bool) bool {
+	for v := d.low; v <= d.high; v++ {
+		if !ok(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// weightedDist picks each value as often as its weight, relative to the
+// others.
+type weightedDist struct {
+	values, weights []int
+	total           int
+}
+
+func (d *weightedDist) pick(rng *rand.Rand) int {
+	n := rng.Intn(d.total)
+	for i, w := range d.weights {
+		if n < w {
+			return d.values[i]
+		}
+		n -= w
+	}
+	return d.values[len(d.values)-1]
+}
+
+func (d *weightedDist) all(ok func(int) bool) bool {
+	return allValues(d.values, d.weights, ok)
+}
+
+// histogramDist picks each value exactly as many times as its count, in a
+// random order. Once every value has been used up it starts again.
+type histogramDist struct {
+	values, counts []int
+	deck           []int
+}
+
+func (d *histogramDist) pick(rng *rand.Rand) int {
+	if len(d.deck) == 0 {
+		for i, v := range d.values {
+			for j := 0; j < d.counts[i]; j++ {
+				d.deck = append(d.deck, v)
+			}
+		}
+		rng.Shuffle(len(d.deck), func(i, j int) {
+			d.deck[i], d.deck[j] = d.deck[j], d.deck[i]
+		})
+	}
+	v := d.deck[len(d.deck)-1]
+	d.deck = d.deck[:len(d.deck)-1]
+	return v
+}
+
+func (d *histogramDist) all(ok func(int) bool) bool {
+	return allValues(d.values, d.counts, ok)
+}
+
+// allValues reports whether ok is true for every value that has a weight
+// or count.
+func allValues(values, counts []int, ok func(int) bool) bool {
+	for i, v := range values {
+		if counts[i] > 0 && !ok(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// Values of a shape dist hold a box's width and length.
+func shapeValue(w, l int) int  { return w<<8 | l }
+func shapeOf(v int) (w, l int) { return v >> 8, v & 0xff }
+
+var errDist = errors.New("distribution must look like \"uniform:LOW-HIGH\", \"weighted:V=W,...\" or \"histogram:V=N,...\"")
+
+// distFromString reads a distribution of numbers, as one of
+//
+//	uniform:1-4        1, 2, 3 or 4, all equally likely
+//	weighted:1=3,4=1   1 three times as often as 4
+//	histogram:1=3,4=1  1, 1, 1 and 4 in a random order, over and over
+func distFromString(in string) (dist, error) {
+	return parseDist(in, strconv.Atoi)
+}
+
+// shapeDistFromString reads a distribution of box shapes, which are written
+// WxL, as in "weighted:1x1=4,2x3=1". Uniform shapes aren't allowed.
+func shapeDistFromString(in string) (dist, error) {
+	if strings.HasPrefix(in, "uniform:") {
+		return nil, errDist
+	}
+	return parseDist(in, func(s string) (int, error) {
+		w, l, ok := strings.Cut(s, "x")
+		if !ok {
+			return 0, errDist
+		}
+		nw, err := strconv.Atoi(w)
+		if err != nil || nw < 1 || nw > 255 {
+			return 0, errDist
+		}
+		nl, err := strconv.Atoi(l)
+		if err != nil || nl < 1 || nl > 255 {
+			return 0, errDist
+		}
+		return shapeValue(nw, nl), nil
+	})
+}
+
+func parseDist(in string, parseValue func(string) (int, error)) (dist, error) {
+	kind, spec, ok := strings.Cut(in, ":")
+	if !ok {
+		return nil, errDist
+	}
+	if kind == "uniform" {
+		low, high, ok := strings.Cut(spec, "-")
+		if !ok {
+			return nil, errDist
+		}
+		var d uniformDist
+		var err1, err2 error
+		d.low, err1 = strconv.Atoi(low)
+		d.high, err2 = strconv.Atoi(high)
+		if err1 != nil || err2 != nil || d.low < 0 || d.high < d.low {
+			return nil, errDist
+		}
+		return d, nil
+	}
+
+	var values, counts []int
+	total := 0
+	for _, part := range strings.Split(spec, ",") {
+		v, c, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, errDist
+		}
+		value, err := parseValue(v)
+		if err != nil || value < 0 {
+			return nil, errDist
+		}
+		count, err := strconv.Atoi(c)
+		if err != nil || count < 0 {
+			return nil, errDist
+		}
+		values = append(values, value)
+		counts = append(counts, count)
+		total += count
+	}
+	if total == 0 {
+		return nil, errDist
+	}
+	switch kind {
+	case "weighted":
+		return &weightedDist{values: values, weights: counts, total: total}, nil
+	case "histogram":
+		return &histogramDist{values: values, counts: counts}, nil
+	}
+	return nil, errDist
+}
+
+// A generator makes random trucks. It has its own source of random numbers,
+// so the trucks it makes only depend on its seed and settings.
+type generator struct {
+	rng  *rand.Rand
+	id   int
+	size palletSize
+	// pallets is how many pallets each truck has, and boxes how many boxes
+	// are tried on each pallet.
+	pallets, boxes dist
+	// widths and lengths are the sizes of boxes. If shapes is set, it is
+	// used instead.
+	widths, lengths dist
+	shapes          dist
+	// legal places boxes where they fit on the pallet, instead of anywhere.
+	legal bool
+}
+
+// newGenerator returns a generator for pallets of the given size, with the
+// distributions the challenge used.
+func newGenerator(seed int64, size palletSize) *generator {
+	return &generator{
+		rng:     rand.New(rand.NewSource(seed)),
+		id:      1,
+		size:    size,
+		pallets: uniformDist{5, 14},
+		boxes:   uniformDist{1, 5},
+		widths:  uniformDist{1, int(size.l)},
+		lengths: uniformDist{1, int(size.w)},
+	}
+}
+
+// check returns an error if the generator could make a box that doesn't
+// fit on its pallets, or a truck or pallet with nothing on it.
+func (g *generator) check() error {
+	within := func(high int) func(int) bool {
+		return func(v int) bool { return v >= 1 && v <= high }
+	}
+	atLeastOne := func(v int) bool { return v >= 1 }
+	if !g.pallets.all(atLeastOne) {
+		return errors.New("trucks must have at least 1 pallet")
+	}
+	if !g.boxes.all(atLeastOne) {
+		return errors.New("pallets must have at least 1 box")
+	}
+	if g.shapes != nil {
+		if !g.shapes.all(func(v int) bool {
+			w, l := shapeOf(v)
+			return g.size.holds(box{w: uint8(w), l: uint8(l)})
+		}) {
+			return fmt.Errorf("box shapes must fit on a %v pallet", g.size)
 		}
-		fmt.Println("endtruck")
+		return nil
+	}
+	if !g.widths.all(within(int(g.size.l))) {
+		return fmt.Errorf("box widths must be from 1 to %d", g.size.l)
 	}
+	if !g.lengths.all(within(int(g.size.w))) {
+		return fmt.Errorf("box lengths must be from 1 to %d", g.size.w)
+	}
+	return nil
 }
 
-var id = 1
+// write writes n random trucks in the given format.
+func (g *generator) write(w io.Writer, n int, format string) error {
+	_, err := g.writeScenario(w, "random", n, format)
+	return err
+}
 
-func nextid() (newid int) {
-	newid = id
-	id++
+func (g *generator) nextid() (newid int) {
+	newid = g.id
+	g.id++
 	return
 }
 
-func gentruck() *truck {
-	t := &truck{id: nextid()}
-	np := randRange(5, 10)
+// truck makes a truck. Pallets that came out with no boxes, because none
+// were tried or none fit, are left out.
+func (g *generator) truck() *truck {
+	t := &truck{id: g.nextid()}
+	np := g.pallets.pick(g.rng)
 
 	for i := 0; i < np; i++ {
-		t.pallets = append(t.pallets, genpal())
+		if p := g.pallet(); len(p.boxes) > 0 {
+			t.pallets = append(t.pallets, p)
+		}
 	}
 	return t
 }
 
-func genpal() (p pallet) {
-	maxsq := palletWidth * palletLength
+func (g *generator) pallet() (p pallet) {
+	if g.legal {
+		return g.legalPallet()
+	}
+	maxsq := g.size.cells()
 
-	nb := randRange(1, 5)
+	nb := g.boxes.pick(g.rng)
 
 	sq := 0
 	for i := 0; i < nb; i++ {
-		b := genbox()
+		b := g.box()
 		sq += int(b.w) * int(b.l)
 		// Stop once the surface area of the boxes is more than the pallet.
 		if sq > maxsq {
@@ -56,15 +296,329 @@ func genpal() (p pallet) {
 	return
 }
 
-func randRange(low, high int) int {
-	return rand.Intn(high) + low
+// legalPallet puts each box at a random place where it fits, turning it
+// if it doesn't fit the way it is. It stops at the first box that fits
+// nowhere, so the pallet is always correctly packed. Boxes too big for the
+// pallet are left out.
+func (g *generator) legalPallet() (p pallet) {
+	used := make([]bool, g.size.cells())
+	nb := g.boxes.pick(g.rng)
+
+	for i := 0; i < nb; i++ {
+		b := g.box()
+		spots := g.spots(used, b)
+		if len(spots) == 0 && b.w != b.l {
+			b.w, b.l = b.l, b.w
+			spots = g.spots(used, b)
+		}
+		if len(spots) == 0 && len(p.boxes) == 0 {
+			// Too big for the pallet at all.
+			continue
+		}
+		if len(spots) == 0 {
+			break
+		}
+		spot := spots[g.rng.Intn(len(spots))]
+		b.x, b.y = spot.x, spot.y
+		for x := int(b.x); x < int(b.x)+int(b.l); x++ {
+			for y := int(b.y); y < int(b.y)+int(b.w); y++ {
+				used[x*int(g.size.l)+y] = true
+			}
+		}
+		p.boxes = append(p.boxes, b)
+	}
+	return
 }
 
-func genbox() (b box) {
-	b.x = uint8(randRange(0, 3))
-	b.y = uint8(randRange(0, 3))
-	b.w = uint8(randRange(1, 4))
-	b.l = uint8(randRange(1, 4))
-	b.id = uint32(nextid())
+// spots returns every place the box fits on the pallet without covering a
+// used cell. Only x and y of each are set.
+func (g *generator) spots(used []bool, b box) (spots []box) {
+	w, l := int(g.size.w), int(g.size.l)
+	for x := 0; x+int(b.l) <= w; x++ {
+		for y := 0; y+int(b.w) <= l; y++ {
+			if g.free(used, x, y, b) {
+				spots = append(spots, box{x: uint8(x), y: uint8(y)})
+			}
+		}
+	}
 	return
 }
+
+// free reports whether the box, with its corner at x, y, only covers cells
+// that aren't used.
+func (g *generator) free(used []bool, x, y int, b box) bool {
+	for i := x; i < x+int(b.l); i++ {
+		for j := y; j < y+int(b.w); j++ {
+			if used[i*int(g.size.l)+j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (g *generator) randRange(low, high int) int {
+	return g.rng.Intn(high) + low
+}
+
+func (g *generator) box() (b box) {
+	b.x = uint8(g.randRange(0, maxInt(int(g.size.w)-1, 1)))
+	b.y = uint8(g.randRange(0, maxInt(int(g.size.l)-1, 1)))
+	if g.shapes != nil {
+		w, l := shapeOf(g.shapes.pick(g.rng))
+		b.w, b.l = uint8(w), uint8(l)
+	} else {
+		b.w = uint8(g.widths.pick(g.rng))
+		b.l = uint8(g.lengths.pick(g.rng))
+	}
+	b.id = uint32(g.nextid())
+	return
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// A scenario is a named family of trucks for trying out packers.
+type scenario struct {
+	about string
+	// trucks makes n trucks and passes each to emit. It returns the best
+	// profit they can be repacked for, or -1 if that isn't known.
+	trucks func(g *generator, n int, emit func(*truck) error) (best int, err error)
+}
+
+var scenarios = map[string]scenario{
+	"random": {
+		about:  "boxes of random sizes, in random places",
+		trucks: randomTrucks,
+	},
+	"unpaired": {
+		about:  "boxes over half the pallet each way, so no two share a layer",
+		trucks: unpairedTrucks,
+	},
+	"fillers": {
+		about:  "lots of 1x1 boxes",
+		trucks: fillerTrucks,
+	},
+	"tiling": {
+		about:  "boxes that tile whole pallets, split across two pallets each",
+		trucks: tilingTrucks,
+	},
+	"carryover": {
+		about:  "tiles split across one truck and the next, so boxes must wait for the next truck",
+		trucks: carryoverTrucks,
+	},
+}
+
+// scenarioNames returns the names of the scenarios, sorted.
+func scenarioNames() []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeScenario writes n trucks of the named scenario in the given format,
+// and returns the best profit for them, or -1 if it isn't known.
+func (g *generator) writeScenario(w io.Writer, name string, n int, format string) (int, error) {
+	sc, ok := scenarios[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown scenario %q", name)
+	}
+	sink, err := newTruckSink(w, format)
+	if err != nil {
+		return 0, err
+	}
+	best, err := sc.trucks(g, n, sink.Write)
+	if err != nil {
+		return 0, err
+	}
+	return best, sink.Close()
+}
+
+// A scenarioBest is what is known about some generated trucks, saved as
+// JSON so that scripts can tell how close a packer gets to the best.
+type scenarioBest struct {
+	Scenario string `json:"scenario"`
+	Trucks   int    `json:"trucks"`
+	Seed     int64  `json:"seed"`
+	Pallet   string `json:"pallet"`
+	// BestProfit is null if it isn't known.
+	BestProfit *int `json:"bestProfit"`
+}
+
+// writeScenarioBest saves what is known about generated trucks to the named
+// file.
+func writeScenarioBest(name string, sb scenarioBest) error {
+	buf, err := json.MarshalIndent(sb, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(name, append(buf, '\n'), 0644)
+}
+
+// bestProfit is the profit when the boxes fill every layer of as few pallets
+// as possible: layers full layers' worth of boxes, out of pallets pallets.
+func (g *generator) bestProfit(pallets, layers int) int {
+	h := g.size.height()
+	return pallets - (layers+h-1)/h
+}
+
+func randomTrucks(g *generator, n int, emit func(*truck) error) (int, error) {
+	for i := 0; i < n; i++ {
+		if err := emit(g.truck()); err != nil {
+			return 0, err
+		}
+	}
+	return -1, nil
+}
+
+// unpairedTrucks has one box on each pallet, which no other box can share
+// a layer with, so the best is to stack them.
+func unpairedTrucks(g *generator, n int, emit func(*truck) error) (int, error) {
+	b := box{w: g.size.l/2 + 1, l: g.size.w/2 + 1}
+	if !b.big(g.size) {
+		// Turned, two would share a layer on a pallet that isn't
+		// square, so make it too long to turn.
+		if g.size.w >= g.size.l {
+			b.l = g.size.w
+		} else {
+			b.w = g.size.l
+		}
+	}
+	pallets := 0
+	for i := 0; i < n; i++ {
+		t := &truck{id: g.nextid()}
+		np := g.pallets.pick(g.rng)
+		for j := 0; j < np; j++ {
+			spots := g.spots(make([]bool, g.size.cells()), b)
+			spot := spots[g.rng.Intn(len(spots))]
+			p := pallet{boxes: []box{{x: spot.x, y: spot.y, w: b.w, l: b.l, id: uint32(g.nextid())}}}
+			t.pallets = append(t.pallets, p)
+		}
+		pallets += np
+		if err := emit(t); err != nil {
+			return 0, err
+		}
+	}
+	return g.bestProfit(pallets, pallets), nil
+}
+
+// fillerTrucks has pallets of 1x1 boxes, up to half full, which can always
+// be packed into full layers.
+func fillerTrucks(g *generator, n int, emit func(*truck) error) (int, error) {
+	g.legal = true
+	g.shapes = &histogramDist{values: []int{shapeValue(1, 1)}, counts: []int{1}}
+	g.boxes = uniformDist{1, maxInt(g.size.cells()/2, 1)}
+	pallets, boxes := 0, 0
+	for i := 0; i < n; i++ {
+		t := g.truck()
+		for _, p := range t.pallets {
+			boxes += len(p.boxes)
+		}
+		pallets += len(t.pallets)
+		if err := emit(t); err != nil {
+			return 0, err
+		}
+	}
+	cells := g.size.cells()
+	return g.bestProfit(pallets, (boxes+cells-1)/cells), nil
+}
+
+// tilingTrucks has boxes that tile whole layers, with the boxes of each
+// layer split across two pallets.
+func tilingTrucks(g *generator, n int, emit func(*truck) error) (int, error) {
+	pallets, layers := 0, 0
+	for i := 0; i < n; i++ {
+		t := &truck{id: g.nextid()}
+		np := g.pallets.pick(g.rng)
+		for j := 0; j < np; j++ {
+			a, b := g.splitTiles()
+			t.pallets = append(t.pallets, a)
+			if len(b.boxes) > 0 {
+				t.pallets = append(t.pallets, b)
+			}
+		}
+		pallets += len(t.pallets)
+		layers += np
+		if err := emit(t); err != nil {
+			return 0, err
+		}
+	}
+	return g.bestProfit(pallets, layers), nil
+}
+
+// carryoverTrucks is like tilingTrucks, but the second half of each layer
+// comes in the next truck. Packing a truck with only its own boxes leaves
+// every layer half full.
+func carryoverTrucks(g *generator, n int, emit func(*truck) error) (int, error) {
+	pallets, layers := 0, 0
+	var carried []pallet
+	for i := 0; i < n; i++ {
+		t := &truck{id: g.nextid(), pallets: carried}
+		carried = nil
+		np := g.pallets.pick(g.rng)
+		for j := 0; j < np; j++ {
+			a, b := g.splitTiles()
+			t.pallets = append(t.pallets, a)
+			if len(b.boxes) == 0 {
+				continue
+			}
+			if i == n-1 {
+				// There is no next truck.
+				t.pallets = append(t.pallets, b)
+			} else {
+				carried = append(carried, b)
+			}
+		}
+		pallets += len(t.pallets)
+		layers += np
+		if err := emit(t); err != nil {
+			return 0, err
+		}
+	}
+	return g.bestProfit(pallets, layers), nil
+}
+
+// splitTiles tiles a layer of the pallet with boxes, and splits them across
+// two pallets where they are. The second is empty if there is only one box.
+func (g *generator) splitTiles() (a, b pallet) {
+	var tiles []box
+	g.tile(0, 0, int(g.size.w), int(g.size.l), true, &tiles)
+	g.rng.Shuffle(len(tiles), func(i, j int) {
+		tiles[i], tiles[j] = tiles[j], tiles[i]
+	})
+	for i, t := range tiles {
+		t.id = uint32(g.nextid())
+		if i == 0 || (i > 1 && g.rng.Intn(2) == 0) {
+			a.boxes = append(a.boxes, t)
+		} else {
+			b.boxes = append(b.boxes, t)
+		}
+	}
+	return
+}
+
+// tile cuts the rows and cols with a corner at x, y into boxes, and adds
+// them to tiles. Each piece is cut again two times out of three, and the
+// whole pallet is always cut.
+func (g *generator) tile(x, y, rows, cols int, cut bool, tiles *[]box) {
+	if rows*cols == 1 || (!cut && g.rng.Intn(3) == 0) {
+		*tiles = append(*tiles, box{x: uint8(x), y: uint8(y), w: uint8(cols), l: uint8(rows)})
+		return
+	}
+	if rows > 1 && (cols == 1 || g.rng.Intn(2) == 0) {
+		n := 1 + g.rng.Intn(rows-1)
+		g.tile(x, y, n, cols, false, tiles)
+		g.tile(x+n, y, rows-n, cols, false, tiles)
+		return
+	}
+	n := 1 + g.rng.Intn(cols-1)
+	g.tile(x, y, rows, n, false, tiles)
+	g.tile(x, y+n, rows, cols-n, false, tiles)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_generator_reproducible(t *testing.T) {
+	gen := func(seed int64) string {
+		g := newGenerator(seed, defaultPalletSize)
+		g.shapes, _ = shapeDistFromString("histogram:1x1=3,2x2=2,4x1=1")
+		var buf bytes.Buffer
+		if err := g.write(&buf, 20, formatText); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+	a := gen(42)
+	// Using the global source in between changes nothing.
+	rand.Seed(1)
+	rand.Int()
+	if b := gen(42); a != b {
+		t.Error("same seed, different trucks")
+	}
+	if c := gen(43); a == c {
+		t.Error("different seed, same trucks")
+	}
+}
+
+func Test_distFromString(t *testing.T) {
+	for _, in := range []string{
+		"uniform",
+		"uniform:3",
+		"uniform:4-2",
+		"weighted:1=0",
+		"weighted:1",
+		"histogram:a=1",
+		"normal:1-2",
+	} {
+		if _, err := distFromString(in); err == nil {
+			t.Errorf("%q: missing error", in)
+		}
+	}
+	for _, in := range []string{"uniform:1x1-2x2", "weighted:2=1", "weighted:2y2=1"} {
+		if _, err := shapeDistFromString(in); err == nil {
+			t.Errorf("%q: missing error", in)
+		}
+	}
+}
+
+func Test_dists(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	u, err := distFromString("uniform:2-4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		seen[u.pick(rng)] = true
+	}
+	if len(seen) != 3 || !seen[2] || !seen[4] {
+		t.Errorf("uniform:2-4 picked %v", seen)
+	}
+
+	w, err := distFromString("weighted:1=9,5=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ones := 0
+	for i := 0; i < 1000; i++ {
+		if w.pick(rng) == 1 {
+			ones++
+		}
+	}
+	if ones < 850 || ones > 950 {
+		t.Errorf("weighted:1=9,5=1 picked 1 %d times in 1000", ones)
+	}
+
+	// A histogram uses each value exactly as often as its count.
+	h, err := shapeDistFromString("histogram:1x1=3,2x3=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := make(map[int]int)
+	for i := 0; i < 8; i++ {
+		counts[h.pick(rng)]++
+	}
+	if counts[shapeValue(1, 1)] != 6 || counts[shapeValue(2, 3)] != 2 {
+		t.Errorf("histogram picked %v", counts)
+	}
+}
+
+func Test_generator_check(t *testing.T) {
+	size := palletSize{w: 4, l: 6}
+	for _, test := range []struct {
+		pallets, boxes          string
+		widths, lengths, shapes string
+		ok                      bool
+	}{
+		{ok: true},
+		{widths: "uniform:1-6", lengths: "weighted:4=1,5=0", ok: true},
+		{shapes: "weighted:6x4=1,4x6=1,1x1=2", ok: true},
+		{widths: "uniform:0-0"},
+		{widths: "uniform:1-7"},
+		{lengths: "histogram:5=1"},
+		{lengths: "uniform:260-260"},
+		{shapes: "weighted:5x5=1"},
+		{shapes: "histogram:1x1=1,7x1=1"},
+		{pallets: "uniform:0-3"},
+		{boxes: "weighted:0=1,2=5"},
+	} {
+		g := newGenerator(1, size)
+		for _, d := range []struct {
+			spec  string
+			dist  *dist
+			parse func(string) (dist, error)
+		}{
+			{test.pallets, &g.pallets, distFromString},
+			{test.boxes, &g.boxes, distFromString},
+			{test.widths, &g.widths, distFromString},
+			{test.lengths, &g.lengths, distFromString},
+			{test.shapes, &g.shapes, shapeDistFromString},
+		} {
+			if d.spec == "" {
+				continue
+			}
+			var err error
+			if *d.dist, err = d.parse(d.spec); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := g.check(); (err == nil) != test.ok {
+			t.Errorf("%+v: wrong err: %v", test, err)
+		}
+	}
+}
+
+func Test_generator_legal(t *testing.T) {
+	for _, size := range []palletSize{{w: 4, l: 4}, {w: 4, l: 6}, {w: 6, l: 3}} {
+		g := newGenerator(7, size)
+		g.legal = true
+		g.boxes = uniformDist{1, 12}
+		if size == defaultPalletSize {
+			// Most boxes are too big for the pallet, which must not
+			// leave any pallet empty.
+			g.shapes, _ = shapeDistFromString("weighted:5x5=3,1x1=1")
+		}
+		var buf bytes.Buffer
+		if err := g.write(&buf, 50, formatText); err != nil {
+			t.Fatal(err)
+		}
+
+		r := newTruckReader(&buf)
+		r.lenient = true
+		saved := defaultPalletSize
+		defaultPalletSize = size
+		c := checkManifest(r)
+		defaultPalletSize = saved
+		if len(c.problems) != 0 {
+			t.Errorf("%v: problems %q", size, c.problems)
+		}
+		if c.trucks != 50 {
+			t.Errorf("%v: %d trucks", size, c.trucks)
+		}
+	}
+}
+
+func Test_scenarios(t *testing.T) {
+	for _, size := range []palletSize{{w: 4, l: 4}, {w: 4, l: 6}, {w: 6, l: 4}, {w: 1, l: 5}, {w: 4, l: 4, h: 2}} {
+		for _, name := range scenarioNames() {
+			g := newGenerator(11, size)
+			var trucks []*truck
+			best, err := scenarios[name].trucks(g, 20, func(t *truck) error {
+				trucks = append(trucks, t)
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(trucks) != 20 {
+				t.Errorf("%s %v: %d trucks", name, size, len(trucks))
+			}
+
+			pallets := 0
+			var boxes []box
+			for _, tr := range trucks {
+				for _, p := range tr.pallets {
+					p.size = size
+					if err := p.IsValid(); err != nil && name != "random" {
+						t.Errorf("%s %v: truck %d: %v", name, size, tr.id, err)
+					}
+					pallets++
+					boxes = append(boxes, p.boxes...)
+				}
+			}
+			if name == "random" {
+				if best != -1 {
+					t.Errorf("random has best profit %d", best)
+				}
+				continue
+			}
+			// Every scenario is laid out so that the boxes can fill as few
+			// pallets as the bound says, and no fewer can do.
+			if need := boundPallets(size, boxes).pallets(); best != pallets-need {
+				t.Errorf("%s %v: best profit %d with %d pallets, but %d are needed", name, size, best, pallets, need)
+			}
+		}
+	}
+}
+
+func Test_tile(t *testing.T) {
+	g := newGenerator(3, palletSize{w: 4, l: 6})
+	for i := 0; i < 20; i++ {
+		a, b := g.splitTiles()
+		if len(a.boxes) == 0 || len(b.boxes) == 0 {
+			t.Fatalf("split %v and %v", a.boxes, b.boxes)
+		}
+		all := pallet{size: g.size, boxes: append(append([]box{}, a.boxes...), b.boxes...)}
+		if err := all.IsValid(); err != nil {
+			t.Fatal(err)
+		}
+		if all.Volume() != g.size.cells() {
+			t.Fatalf("tiles cover %d cells of %d", all.Volume(), g.size.cells())
+		}
+	}
+}
+
+func Test_writeScenarioBest(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "best.json")
+	best := 7
+	if err := writeScenarioBest(name, scenarioBest{Scenario: "tiling", Trucks: 20, Seed: 1, Pallet: "4x4", BestProfit: &best}); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got["scenario"] != "tiling" || got["bestProfit"] != 7.0 {
+		t.Errorf("saved %s", buf)
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// guillotineChoice decides which free rectangle a box is placed in.
+type guillotineChoice int
+
+const (
+	// Best Area Fit: the smallest leftover area.
+	guillotineBAF guillotineChoice = iota
+	// Best Short Side Fit: the smallest shorter leftover side.
+	guillotineBSSF
+	// Best Long Side Fit: the smallest longer leftover side.
+	guillotineBLSF
+	// Worst Area Fit: the largest leftover area.
+	guillotineWAF
+	// Worst Short Side Fit: the largest shorter leftover side.
+	guillotineWSSF
+	// Worst Long Side Fit: the largest longer leftover side.
+	guillotineWLSF
+)
+
+var guillotineChoices = []guillotineChoice{
+	guillotineBAF, guillotineBSSF, guillotineBLSF,
+	guillotineWAF, guillotineWSSF, guillotineWLSF,
+}
+
+func (c guillotineChoice) String() string {
+	switch c {
+	case guillotineBAF:
+		return "baf"
+	case guillotineBSSF:
+		return "bssf"
+	case guillotineBLSF:
+		return "blsf"
+	case guillotineWAF:
+		return "waf"
+	case guillotineWSSF:
+		return "wssf"
+	case guillotineWLSF:
+		return "wlsf"
+	}
+	return fmt.Sprintf("guillotineChoice(%d)", int(c))
+}
+
+// guillotineSplit decides how the space left in a free rectangle is cut in
+// two after a box is placed in its corner.
+type guillotineSplit int
+
+const (
+	// Cut along the shorter leftover side.
+	guillotineSLAS guillotineSplit = iota
+	// Cut along the longer leftover side.
+	guillotineLLAS
+	// Cut so that the smaller of the two pieces is as small as possible.
+	guillotineMINAS
+	// Cut so that the larger of the two pieces is as large as possible.
+	guillotineMAXAS
+)
+
+var guillotineSplits = []guillotineSplit{
+	guillotineSLAS, guillotineLLAS, guillotineMINAS, guillotineMAXAS,
+}
+
+func (s guillotineSplit) String() string {
+	switch s {
+	case guillotineSLAS:
+		return "slas"
+	case guillotineLLAS:
+		return "llas"
+	case guillotineMINAS:
+		return "minas"
+	case guillotineMAXAS:
+		return "maxas"
+	}
+	return fmt.Sprintf("guillotineSplit(%d)", int(s))
+}
+
+// guillotine tracks the free rectangles on a pallet that is only ever cut
+// edge to edge, as described in section 4 of RectangleBinPack.pdf. Every
+// layout it makes can be taken apart with straight cuts.
+type guillotine struct {
+	size   palletSize
+	choice guillotineChoice
+	split  guillotineSplit
+	merge  bool
+	free   []rect
+}
+
+// newGuillotine initializes an empty pallet of the given size.
+func newGuillotine(size palletSize, c guillotineChoice, s guillotineSplit, merge bool) *guillotine {
+	return &guillotine{
+		size:   size,
+		choice: c,
+		split:  s,
+		merge:  merge,
+		free:   []rect{palletRect(size)},
+	}
+}
+
+// score rates placing a box of size w by l in free rectangle f. Lower is
+// better.
+func (g *guillotine) score(f rect, w, l uint8) int {
+	lw, ll := int(f.w)-int(w), int(f.l)-int(l)
+	short, long := lw, ll
+	if short > long {
+		short, long = long, short
+	}
+	area := int(f.w)*int(f.l) - int(w)*int(l)
+	switch g.choice {
+	case guillotineBSSF:
+		return short
+	case guillotineBLSF:
+		return long
+	case guillotineWAF:
+		return -area
+	case guillotineWSSF:
+		return -short
+	case guillotineWLSF:
+		return -long
+	}
+	return area
+}
+
+// find returns the best free rectangle for the box, and the box rotated to
+// fit it. If the box does not fit, ok is false.
+func (g *guillotine) find(b box) (best box, fi, s int, ok bool) {
+	for i, f := range g.free {
+		for _, rot := range []func(*box){upright, sideways} {
+			c := b
+			rot(&c)
+			if c.w > f.w || c.l > f.l {
+				continue
+			}
+			// A perfect fit can't be beaten.
+			n := g.score(f, c.w, c.l)
+			if c.w == f.w && c.l == f.l {
+				n = -g.size.cells() * 2
+			}
+			if !ok || n < s {
+				c.x, c.y = f.x, f.y
+				best, fi, s, ok = c, i, n, true
+			}
+		}
+	}
+	return
+}
+
+// place puts the box in the corner of free rectangle fi, and cuts the rest
+// of that rectangle in two.
+func (g *guillotine) place(b box, fi int) {
+	f := g.free[fi]
+	g.free = append(g.free[:fi], g.free[fi+1:]...)
+
+	// Leftover along x and along y.
+	lx, ly := int(f.l)-int(b.l), int(f.w)-int(b.w)
+
+	var alongY bool
+	switch g.split {
+	case guillotineSLAS:
+		alongY = lx <= ly
+	case guillotineLLAS:
+		alongY = lx > ly
+	case guillotineMINAS:
+		alongY = int(b.l)*ly > lx*int(b.w)
+	case guillotineMAXAS:
+		alongY = int(b.l)*ly <= lx*int(b.w)
+	}
+
+	// The piece past the box along y, and the piece past it along x. One of
+	// them gets the full extent of the free rectangle.
+	py := rect{x: f.x, y: f.y + b.w, w: f.w - b.w, l: b.l}
+	px := rect{x: f.x + b.l, y: f.y, w: b.w, l: f.l - b.l}
+	if alongY {
+		py.l = f.l
+	} else {
+		px.w = f.w
+	}
+	if py.w > 0 && py.l > 0 {
+		g.free = append(g.free, py)
+	}
+	if px.w > 0 && px.l > 0 {
+		g.free = append(g.free, px)
+	}
+
+	if g.merge {
+		g.mergeFree()
+	}
+}
+
+// mergeFree joins pairs of free rectangles that line up exactly to form a
+// bigger rectangle.
+func (g *guillotine) mergeFree() {
+	for i := 0; i < len(g.free); i++ {
+		for j := i + 1; j < len(g.free); j++ {
+			a, b := g.free[i], g.free[j]
+			merged := false
+			switch {
+			case a.x == b.x && a.l == b.l && a.y+a.w == b.y:
+				g.free[i].w += b.w
+				merged = true
+			case a.x == b.x && a.l == b.l && b.y+b.w == a.y:
+				g.free[i].y = b.y
+				g.free[i].w += b.w
+				merged = true
+			case a.y == b.y && a.w == b.w && a.x+a.l == b.x:
+				g.free[i].l += b.l
+				merged = true
+			case a.y == b.y && a.w == b.w && b.x+b.l == a.x:
+				g.free[i].x = b.x
+				g.free[i].l += b.l
+				merged = true
+			}
+			if merged {
+				g.free = append(g.free[:j], g.free[j+1:]...)
+				j = i
+			}
+		}
+	}
+}
+
+// guillotinePacker returns a Packer that uses the Guillotine algorithm with
+// the given rules.
+func guillotinePacker(c guillotineChoice, s guillotineSplit, merge bool) Packer {
+	return PackerFunc(func(pal *pallet, boxes []box) []box {
+		return packWithGuillotineRules(pal, boxes, c, s, merge)
+	})
+}
+
+// packWithGuillotine fills a pallet with the Guillotine algorithm, using Best
+// Area Fit, the Shorter Leftover Axis split and merging. It returns the boxes
+// that were not put onto the pallet.
+func packWithGuillotine(pal *pallet, boxes []box) []box {
+	return packWithGuillotineRules(pal, boxes, guillotineBAF, guillotineSLAS, true)
+}
+
+// packWithGuillotineRules fills a pallet by repeatedly placing the box that
+// scores best in any free rectangle. Bigger boxes are preferred when scores
+// tie.
+func packWithGuillotineRules(pal *pallet, boxes []box, c guillotineChoice, s guillotineSplit, merge bool) []box {
+	g := newGuillotine(pal.dims(), c, s, merge)
+
+	remaining := make([]box, len(boxes))
+	copy(remaining, boxes)
+	sort.Stable(byArea(remaining))
+
+	for len(remaining) > 0 {
+		bi, fi := -1, -1
+		var best box
+		var score int
+		for i, b := range remaining {
+			p, f, n, ok := g.find(b)
+			if ok && (bi < 0 || n < score) {
+				bi, fi, best, score = i, f, p, n
+			}
+		}
+		if bi < 0 {
+			break
+		}
+		if debug {
+			fmt.Printf("  + guillotine(%s, %s) box %v\n", c, s, best)
+		}
+		g.place(best, fi)
+		pal.boxes = append(pal.boxes, best)
+		remaining = append(remaining[:bi], remaining[bi+1:]...)
+	}
+	return remaining
+}
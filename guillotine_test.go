@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func Test_guillotine_place(t *testing.T) {
+	tests := []struct {
+		split guillotineSplit
+		want  []rect
+	}{
+		{
+			// 2 left along x, 1 along y: the piece past the box
+			// along x keeps the full width.
+			split: guillotineSLAS,
+			want:  []rect{{0, 3, 1, 2}, {2, 0, 4, 2}},
+		},
+		{
+			split: guillotineLLAS,
+			want:  []rect{{0, 3, 1, 4}, {2, 0, 3, 2}},
+		},
+	}
+	for i, test := range tests {
+		g := newGuillotine(palletSize{w: 4, l: 4}, guillotineBAF, test.split, false)
+		g.place(box{x: 0, y: 0, w: 3, l: 2, id: 99}, 0)
+		if len(g.free) != len(test.want) {
+			t.Errorf("%d: got %v, want %v", i, g.free, test.want)
+			continue
+		}
+		for j := range test.want {
+			if g.free[j] != test.want[j] {
+				t.Errorf("%d: free %d: got %v, want %v", i, j, g.free[j], test.want[j])
+			}
+		}
+	}
+}
+
+func Test_guillotine_mergeFree(t *testing.T) {
+	g := newGuillotine(palletSize{w: 4, l: 4}, guillotineBAF, guillotineSLAS, true)
+	g.free = []rect{{0, 2, 2, 2}, {0, 0, 2, 2}, {2, 0, 4, 2}}
+	g.mergeFree()
+	if len(g.free) != 1 || g.free[0] != (rect{0, 0, 4, 4}) {
+		t.Errorf("got %v, want one 4x4 rect", g.free)
+	}
+}
+
+func Test_packWithGuillotine(t *testing.T) {
+	boxes := []box{
+		{x: 0, y: 0, w: 4, l: 2, id: 90},
+		{x: 0, y: 0, w: 2, l: 2, id: 91},
+		{x: 0, y: 0, w: 2, l: 1, id: 92},
+		{x: 0, y: 0, w: 2, l: 1, id: 93},
+	}
+	pal := &pallet{}
+	unused := packWithGuillotine(pal, boxes)
+	if err := pal.IsValid(); err != nil {
+		t.Fatalf("pallet is not packed correctly: %s", err)
+	}
+	if len(unused) != 0 {
+		t.Errorf("got %d unused boxes, want 0%s", len(unused), pal)
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"unicode"
+)
+
+// Truck formats. Auto picks json, ndjson or text from the first byte of the
+// input.
+const (
+	formatAuto   = "auto"
+	formatText   = "text"
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+)
+
+var formats = []string{formatAuto, formatText, formatJSON, formatNDJSON}
+
+// truckFormat is the format trucks are read in. It can be changed on the
+// command line.
+var truckFormat = formatAuto
+
+// A truckSource returns trucks one at a time, and io.EOF after the last one.
+type truckSource interface {
+	Next() (*truck, error)
+}
+
+// A skippingSource is a truckSource that can skip trucks it can't read, and
+// say which ones it skipped.
+type skippingSource interface {
+	truckSource
+	Skipped() []*ParseError
+}
+
+// A truckSink writes trucks one at a time. Close must be called after the
+// last one.
+type truckSink interface {
+	Write(*truck) error
+	Close() error
+}
+
+type errFormat string
+
+func (e errFormat) Error() string {
+	return fmt.Sprintf("unknown format %q", string(e))
+}
+
+// newTruckSource returns a reader for trucks in the given format.
+func newTruckSource(r io.Reader, format string) (truckSource, error) {
+	if format == formatAuto {
+		br := bufio.NewReader(r)
+		format = detectFormat(br)
+		r = br
+	}
+	switch format {
+	case formatText:
+		return newTruckReader(r), nil
+	case formatJSON, formatNDJSON:
+		return newJSONTruckReader(r), nil
+	}
+	return nil, errFormat(format)
+}
+
+// newTruckSink returns a writer for trucks in the given format. Auto writes
+// text.
+func newTruckSink(w io.Writer, format string) (truckSink, error) {
+	switch format {
+	case formatAuto, formatText:
+		return newTruckWriter(w), nil
+	case formatJSON, formatNDJSON:
+		return newJSONTruckWriter(w, format == formatNDJSON), nil
+	}
+	return nil, errFormat(format)
+}
+
+// errSinkClosed is returned for trucks written after their sink is closed.
+var errSinkClosed = errors.New("the sink is closed")
+
+// A sharedSink is a truckSink that can be written and closed from different
+// goroutines. Closing it again does nothing, and trucks written after it is
+// closed are not saved.
+type sharedSink struct {
+	mu     sync.Mutex
+	sink   truckSink
+	closed bool
+}
+
+// Write implements truckSink.
+func (s *sharedSink) Write(t *truck) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errSinkClosed
+	}
+	return s.sink.Write(t)
+}
+
+// Close implements truckSink.
+func (s *sharedSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.sink.Close()
+}
+
+// detectFormat looks at the first byte that isn't a space: a JSON array is
+// json, an object is ndjson, and anything else is text.
+func detectFormat(br *bufio.Reader) string {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return formatText
+		}
+		if unicode.IsSpace(rune(c)) {
+			continue
+		}
+		br.UnreadByte()
+		switch c {
+		case '[':
+			return formatJSON
+		case '{':
+			return formatNDJSON
+		}
+		return formatText
+	}
+}
+
+// jsonBox is a box as it appears in JSON.
+type jsonBox struct {
+	X       uint8  `json:"x"`
+	Y       uint8  `json:"y"`
+	Z       uint8  `json:"z,omitempty"`
+	W       uint8  `json:"w"`
+	L       uint8  `json:"l"`
+	H       uint8  `json:"h,omitempty"`
+	ID      uint32 `json:"id"`
+	Weight  uint32 `json:"weight,omitempty"`
+	Locked  bool   `json:"locked,omitempty"`
+	Fragile bool   `json:"fragile,omitempty"`
+	Hazard  uint8  `json:"hazard,omitempty"`
+	Temp    uint8  `json:"temp,omitempty"`
+}
+
+// jsonPallet is a pallet as it appears in JSON.
+type jsonPallet struct {
+	Boxes []jsonBox `json:"boxes"`
+}
+
+// jsonPalletSize is a pallet size as it appears in JSON.
+type jsonPalletSize struct {
+	W         uint8  `json:"w"`
+	L         uint8  `json:"l"`
+	H         uint8  `json:"h,omitempty"`
+	MaxWeight uint32 `json:"maxWeight,omitempty"`
+}
+
+// jsonTruck is a truck as it appears in JSON. Trucks with no pallet size
+// carry pallets of the default size.
+type jsonTruck struct {
+	ID      int             `json:"id"`
+	Pallet  *jsonPalletSize `json:"pallet,omitempty"`
+	Pallets []jsonPallet    `json:"pallets"`
+}
+
+func toJSONTruck(t *truck) jsonTruck {
+	jt := jsonTruck{ID: t.id, Pallets: make([]jsonPallet, len(t.pallets))}
+	if t.size != (palletSize{}) {
+		s := t.size
+		jt.Pallet = &jsonPalletSize{W: s.w, L: s.l, H: s.h, MaxWeight: s.maxWeight}
+	}
+	for i, p := range t.pallets {
+		jp := jsonPallet{Boxes: make([]jsonBox, len(p.boxes))}
+		for j, b := range p.boxes {
+			jp.Boxes[j] = jsonBox{
+				X: b.x, Y: b.y, Z: b.z,
+				W: b.w, L: b.l, H: b.h,
+				ID:      b.id,
+				Weight:  b.weight,
+				Locked:  b.locked,
+				Fragile: b.fragile,
+				Hazard:  b.hazard,
+				Temp:    b.temp,
+			}
+		}
+		jt.Pallets[i] = jp
+	}
+	return jt
+}
+
+// fromJSONTruck checks a truck read from JSON the way the text format is
+// checked, and converts it.
+func fromJSONTruck(jt jsonTruck) (*truck, error) {
+	t := &truck{id: jt.ID}
+	if s := jt.Pallet; s != nil {
+		if s.W == 0 || s.L == 0 {
+			return nil, errPalletSize
+		}
+		t.size = palletSize{w: s.W, l: s.L, h: s.H, maxWeight: s.MaxWeight}
+	}
+	for _, jp := range jt.Pallets {
+		p := pallet{size: t.size}
+		if len(jp.Boxes) == 0 {
+			return nil, errEmpty
+		}
+		for _, jb := range jp.Boxes {
+			b := box{
+				x: jb.X, y: jb.Y, z: jb.Z,
+				w: jb.W, l: jb.L, h: jb.H,
+				id:      jb.ID,
+				weight:  jb.Weight,
+				locked:  jb.Locked,
+				fragile: jb.Fragile,
+				hazard:  jb.Hazard,
+				temp:    jb.Temp,
+			}
+			if b == emptybox {
+				return nil, errEmpty
+			}
+			if b.w == 0 && b.l == 0 {
+				return nil, errZeroBox
+			}
+			p.boxes = append(p.boxes, b)
+		}
+		t.pallets = append(t.pallets, p)
+	}
+	return t, nil
+}
+
+// A jsonTruckReader reads trucks from a JSON array of trucks, or from
+// newline-delimited JSON with one truck per line. A lenient reader skips
+// trucks that can't be read, as long as it can find where the next one
+// starts: that is any line of newline-delimited JSON, but only a well-formed
+// value in an array.
+type jsonTruckReader struct {
+	br      *bufio.Reader
+	lines   *lineCounter
+	dec     *json.Decoder
+	array   bool
+	started bool
+	err     error
+	lenient bool
+	skipped []*ParseError
+}
+
+func newJSONTruckReader(r io.Reader) *jsonTruckReader {
+	lc := &lineCounter{r: r}
+	return &jsonTruckReader{br: bufio.NewReader(lc), lines: lc, lenient: lenientParsing}
+}
+
+func (r *jsonTruckReader) Next() (*truck, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if !r.started {
+		r.started = true
+		// Read the opening bracket of an array of trucks, if there is one.
+		r.array = detectFormat(r.br) == formatJSON
+		if r.array {
+			r.dec = json.NewDecoder(r.br)
+			if _, r.err = r.dec.Token(); r.err != nil {
+				return nil, r.err
+			}
+		}
+	}
+	for {
+		raw, line, col, err := r.next()
+		if err != nil {
+			r.err = err
+			return nil, err
+		}
+		var jt jsonTruck
+		e := &ParseError{Line: line, Column: col, Truck: -1}
+		if e.Err = json.Unmarshal(raw, &jt); e.Err == nil {
+			var t *truck
+			if t, e.Err = fromJSONTruck(jt); e.Err == nil {
+				return t, nil
+			}
+			e.Truck = jt.ID
+		}
+		if !r.lenient {
+			r.err = e
+			return nil, e
+		}
+		r.skipped = append(r.skipped, e)
+	}
+}
+
+// next returns the next truck as raw JSON, and the line and column it
+// starts at.
+func (r *jsonTruckReader) next() (json.RawMessage, int, int, error) {
+	if !r.array {
+		for {
+			start := r.lines.n - int64(r.br.Buffered())
+			buf, err := r.br.ReadBytes('\n')
+			if len(buf) == 0 && err != nil {
+				return nil, 0, 0, err
+			}
+			if trimmed := bytes.TrimSpace(buf); len(trimmed) > 0 {
+				line, col := r.lines.position(start + int64(bytes.Index(buf, trimmed[:1])))
+				return trimmed, line, col, nil
+			}
+		}
+	}
+
+	if !r.dec.More() {
+		_, err := r.dec.Token()
+		if err == nil {
+			err = io.EOF
+		}
+		return nil, 0, 0, err
+	}
+	var raw json.RawMessage
+	if err := r.dec.Decode(&raw); err != nil {
+		if se, ok := err.(*json.SyntaxError); ok {
+			line, col := r.lines.position(se.Offset)
+			return nil, 0, 0, &ParseError{Line: line, Column: col, Truck: -1, Err: err}
+		}
+		return nil, 0, 0, err
+	}
+	line, col := r.lines.position(r.dec.InputOffset() - int64(len(raw)))
+	return raw, line, col, nil
+}
+
+// Skipped returns the errors for the trucks that a lenient reader skipped.
+func (r *jsonTruckReader) Skipped() []*ParseError {
+	return r.skipped
+}
+
+// A lineCounter passes on what it reads, and remembers where the lines
+// start, so that an offset can be turned into a line and a column. Offsets
+// must be asked about in order.
+type lineCounter struct {
+	r io.Reader
+	n int64
+	// line, from 0, starts at offset start, and starts are where the lines
+	// after it start.
+	line   int
+	start  int64
+	starts []int64
+}
+
+func (lc *lineCounter) Read(p []byte) (int, error) {
+	n, err := lc.r.Read(p)
+	for i, c := range p[:n] {
+		if c == '\n' {
+			lc.starts = append(lc.starts, lc.n+int64(i)+1)
+		}
+	}
+	lc.n += int64(n)
+	return n, err
+}
+
+// position returns the line and column, both from 1, of an offset.
+func (lc *lineCounter) position(offset int64) (line, col int) {
+	// Lines before the offset are never asked about again.
+	i := sort.Search(len(lc.starts), func(i int) bool { return lc.starts[i] > offset })
+	if i > 0 {
+		lc.line += i
+		lc.start = lc.starts[i-1]
+		lc.starts = lc.starts[i:]
+	}
+	return lc.line + 1, int(offset-lc.start) + 1
+}
+
+// A jsonTruckWriter writes trucks as a JSON array, or as newline-delimited
+// JSON. Close must be called after the last truck.
+type jsonTruckWriter struct {
+	w      io.Writer
+	ndjson bool
+	n      int
+}
+
+func newJSONTruckWriter(w io.Writer, ndjson bool) *jsonTruckWriter {
+	return &jsonTruckWriter{w: w, ndjson: ndjson}
+}
+
+// Write writes one truck.
+func (w *jsonTruckWriter) Write(t *truck) error {
+	buf, err := json.Marshal(toJSONTruck(t))
+	if err != nil {
+		return err
+	}
+	var sep, end string
+	switch {
+	case w.ndjson:
+		end = "\n"
+	case w.n == 0:
+		sep = "[\n"
+	default:
+		sep = ",\n"
+	}
+	w.n++
+	_, err = fmt.Fprintf(w.w, "%s%s%s", sep, buf, end)
+	return err
+}
+
+// Close finishes the array of trucks.
+func (w *jsonTruckWriter) Close() error {
+	if w.ndjson {
+		return nil
+	}
+	end := "\n]\n"
+	if w.n == 0 {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.w, end)
+	return err
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testJSONTrucks = `truck 1
+0 0 1 1 101,1 1 1 1 102,2 2 1 1 103,3 0 4 1 104
+0 0 5 5 105
+endtruck
+truck 2 pallet=4x6x2 maxweight=50
+0 0 2 3 106 12 lock=1 fragile=1,2 0 1 1 107 z=1 h=2 hazard=3 temp=1
+endtruck
+`
+
+// readAll reads every truck from a source.
+func readAll(t *testing.T, src truckSource) []*truck {
+	var trucks []*truck
+	for {
+		tr, err := src.Next()
+		if err == io.EOF {
+			return trucks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		trucks = append(trucks, tr)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	f, err := os.ReadFile("testdata/100trucks.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range []string{testJSONTrucks, string(f)} {
+		src, err := newTruckSource(strings.NewReader(in), formatAuto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := readAll(t, src)
+
+		for _, ndjson := range []bool{false, true} {
+			var buf bytes.Buffer
+			w := newJSONTruckWriter(&buf, ndjson)
+			for _, tr := range want {
+				if err := w.Write(tr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			src, err := newTruckSource(&buf, formatAuto)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := readAll(t, src)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ndjson %v: trucks changed in JSON", ndjson)
+			}
+		}
+	}
+
+	// And back to text.
+	src, _ := newTruckSource(strings.NewReader(testJSONTrucks), formatText)
+	trucks := readAll(t, src)
+	lines := strings.Split(testJSONTrucks, "\n")
+	if got := trucks[1].pallets[0].OneLine(); got != lines[5] {
+		t.Errorf("got %q, want %q", got, lines[5])
+	}
+}
+
+func TestJSONTruckReader(t *testing.T) {
+	in := `{"id":7,"pallet":{"w":4,"l":6},"pallets":[{"boxes":[{"x":0,"y":0,"w":2,"l":2,"id":101,"locked":true}]}]}
+{"id":8,"pallets":[{"boxes":[{"x":1,"y":1,"w":1,"l":1,"id":102}]}]}
+`
+	src, err := newTruckSource(strings.NewReader(in), formatNDJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trucks := readAll(t, src)
+	if len(trucks) != 2 || trucks[0].dims() != (palletSize{w: 4, l: 6}) || trucks[1].dims() != defaultPalletSize {
+		t.Fatalf("wrong trucks: %+v", trucks)
+	}
+	if b := trucks[0].pallets[0].boxes[0]; !b.locked || b.id != 101 {
+		t.Errorf("wrong box: %v", b)
+	}
+	if trucks[0].pallets[0].dims() != trucks[0].dims() {
+		t.Error("pallet doesn't have the truck's size")
+	}
+
+	for _, bad := range []string{
+		`[{"id":1,"pallets":[{"boxes":[]}]}]`,
+		`[{"id":1,"pallets":[{"boxes":[{"x":1,"y":1,"id":101}]}]}]`,
+		`[{"id":1,"pallet":{"w":4},"pallets":[]}]`,
+		`[{"id":1,"pallets":[`,
+	} {
+		src, _ := newTruckSource(strings.NewReader(bad), formatAuto)
+		if _, err := src.Next(); err == nil || err == io.EOF {
+			t.Errorf("%s: wrong err: %v", bad, err)
+		}
+	}
+
+	if _, err := newTruckSource(strings.NewReader(""), "xml"); err == nil {
+		t.Error("missing error")
+	}
+	src, _ = newTruckSource(strings.NewReader("[]"), formatAuto)
+	if _, err := src.Next(); err != io.EOF {
+		t.Error("expected eof, got:", err)
+	}
+}
+
+func TestLenientJSONTruckReader(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want []ParseError
+	}{
+		{
+			in: `{"id":1,"pallets":[{"boxes":[{"x":0,"y":0,"w":1,"l":1,"id":101}]}]}
+{"id":2,"pallets":[{"boxes":[{"x":0,
+  {"id":3,"pallets":[{"boxes":[]}]}
+
+{"id":4,"pallets":[{"boxes":[{"x":0,"y":0,"w":1,"l":1,"id":104}]}]}
+`,
+			want: []ParseError{{Line: 2, Column: 1, Truck: -1}, {Line: 3, Column: 3, Truck: 3}},
+		},
+		{
+			in: `[
+{"id":1,"pallets":[{"boxes":[{"x":0,"y":0,"w":1,"l":1,"id":101}]}]},
+{"id":2,"pallets":[{"boxes":[{"x":"a"}]}]}, {"id":3,"pallet":{"w":4},"pallets":[]},
+{"id":4,"pallets":[{"boxes":[{"x":0,"y":0,"w":1,"l":1,"id":104}]}]}
+]`,
+			want: []ParseError{{Line: 3, Column: 1, Truck: -1}, {Line: 3, Column: 45, Truck: 3}},
+		},
+	} {
+		r := newJSONTruckReader(strings.NewReader(test.in))
+		r.lenient = true
+		var ids []int
+		for _, tr := range readAll(t, r) {
+			ids = append(ids, tr.id)
+		}
+		if want := []int{1, 4}; !reflect.DeepEqual(ids, want) {
+			t.Errorf("read trucks %v, want %v", ids, want)
+		}
+		skipped := r.Skipped()
+		if len(skipped) != len(test.want) {
+			t.Fatalf("skipped %v", skipped)
+		}
+		for i, w := range test.want {
+			got := *skipped[i]
+			if got.Line != w.Line || got.Column != w.Column || got.Truck != w.Truck {
+				t.Errorf("skipped %d: %v, want line %d, column %d, truck %d", i, skipped[i], w.Line, w.Column, w.Truck)
+			}
+		}
+	}
+
+	// A reader that isn't lenient says where the first bad truck is.
+	r := newJSONTruckReader(strings.NewReader("\n\n{\"id\":3,\"pallets\":[{\"boxes\":[]}]}\n"))
+	_, err := r.Next()
+	if pe, ok := err.(*ParseError); !ok || pe.Line != 3 || pe.Truck != 3 {
+		t.Errorf("wrong err: %v", err)
+	}
+}
+
+func TestSharedSink(t *testing.T) {
+	var buf bytes.Buffer
+	s := &sharedSink{sink: newJSONTruckWriter(&buf, false)}
+	if err := s.Write(&truck{id: 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	// A truck that comes back after the sink is closed isn't saved, and
+	// closing again leaves the array finished.
+	if err := s.Write(&truck{id: 2}); err != errSinkClosed {
+		t.Errorf("write after close: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+	var trucks []jsonTruck
+	if err := json.Unmarshal(buf.Bytes(), &trucks); err != nil || len(trucks) != 1 {
+		t.Errorf("saved %q: %v", buf.String(), err)
+	}
+}
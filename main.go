@@ -9,6 +9,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -16,28 +17,81 @@ import (
 type result struct {
 	profit, items int
 	fail          bool
+	// weight is what the correctly packed pallets with a weight limit
+	// carry, and capacity is how much they could carry.
+	weight, capacity int
+	// truck is the repacked truck, and size is the size of its pallets. It
+	// is nil for problems that aren't about one truck.
+	truck *truck
+	size  palletSize
+	// pallets is how many pallets the truck came in with, and elapsed is
+	// how long it took from arriving to leaving.
+	pallets int
+	elapsed time.Duration
+	// bound is the fewest pallets the boxes the truck left with could need.
+	bound palletBound
+	// failures says what was wrong, if anything.
+	failures []failure
 }
 
 type accounting struct {
 	trucksMu, boxesMu sync.Mutex
 	trucks            map[int]int
 	boxes             map[box]bool
+	// sizes is the pallet size of each truck, and last picks one of them
+	// for the last truck.
+	sizes map[int]palletSize
+	last  lastSize
+	// inbound keeps the pallets each truck came in with, if it isn't nil.
+	inbound map[int][]pallet
+	// arrived is when each truck was read, and timedOut is set if trucks
+	// stopped being read because time ran out.
+	arrived  map[int]time.Time
+	timedOut bool
+	// skipped are the trucks that couldn't be read, in lenient mode.
+	skipped []*ParseError
+	// input collects a bound over all of the boxes read.
+	input boxesBound
 }
 
-func process(doneTime time.Time, r io.Reader, a *accounting, resultChan chan result) {
+// newAccounting returns an accounting with nothing read yet.
+func newAccounting() *accounting {
+	return &accounting{
+		trucks:  make(map[int]int),
+		boxes:   make(map[box]bool),
+		sizes:   make(map[int]palletSize),
+		arrived: make(map[int]time.Time),
+	}
+}
+
+func process(doneTime, finalTime time.Time, r io.Reader, a *accounting, resultChan chan result, w truckSink) {
 	defer close(resultChan)
+	if w != nil {
+		defer func() {
+			if err := w.Close(); err != nil {
+				log.Print("writing trucks: ", err)
+			}
+		}()
+	}
 
-	tr := newTruckReader(r)
+	tr, err := newTruckSource(r, truckFormat)
+	if err != nil {
+		log.Print(err)
+		return
+	}
 	in := make(chan *truck)
 	out := make(chan *truck)
 
 	// Construct the repacker.
-	newRepacker(in, out)
+	newRepacker(in, out, doneTime, finalTime)
 
 	// A goroutine to read and send trucks
 	go func() {
 		defer close(in)
 
+		// A truck with the last truck's id, as in a saved manifest, isn't
+		// sent on its own. Its pallets leave with the last truck instead.
+		var held []pallet
 		for {
 			done := time.Now().After(doneTime)
 
@@ -52,11 +106,20 @@ func process(doneTime time.Time, r io.Reader, a *accounting, resultChan chan res
 				}
 
 				// Send one more empty truck as a signal that they now
-				// need to send out any stored boxes.
+				// need to send out any stored boxes. Its pallets are the
+				// biggest that arrived, which can hold boxes from any
+				// truck if any size can.
 				a.trucksMu.Lock()
-				a.trucks[idLastTruck] = 0
+				if s, ok := tr.(skippingSource); ok {
+					a.skipped = s.Skipped()
+				}
+				a.timedOut = done
+				a.trucks[idLastTruck] = len(held)
+				a.arrived[idLastTruck] = time.Now()
+				last := &truck{id: idLastTruck, pallets: held, size: a.last.size()}
+				a.sizes[idLastTruck] = last.dims()
 				a.trucksMu.Unlock()
-				in <- &truck{id: idLastTruck}
+				in <- last
 
 				return
 			}
@@ -69,42 +132,78 @@ func process(doneTime time.Time, r io.Reader, a *accounting, resultChan chan res
 			}
 			a.boxesMu.Unlock()
 
-			// Remember how many pallets were in the truck.
+			// Remember how many pallets were in the truck, and their size.
 			a.trucksMu.Lock()
 			a.trucks[t.id] = len(t.pallets)
+			a.sizes[t.id] = t.dims()
+			a.last.add(t)
+			a.arrived[t.id] = time.Now()
+			a.input.add(t.dims(), truckBoxes(t))
+			if t.id == idLastTruck {
+				held = append(held, t.pallets...)
+			}
+			if a.inbound != nil {
+				a.inbound[t.id] = append(a.inbound[t.id], t.pallets...)
+			}
 			a.trucksMu.Unlock()
 
-			in <- t
+			if t.id != idLastTruck {
+				in <- t
+			}
 		}
 	}()
 
-	// Receive the trucks and check them.
+	// Receive the trucks, save them and check them.
 	for t := range out {
-		r := result{}
+		r := result{truck: t}
 
-		// Only correctly packed pallets count
+		// Only correctly packed pallets count. They must fit the pallets
+		// the truck came in with.
+		a.trucksMu.Lock()
+		size := a.sizes[t.id]
+		a.trucksMu.Unlock()
+
+		// Every truck is saved, with its pallet size, so that the saved
+		// trucks can be read back without knowing the sizes.
+		if w != nil {
+			saved := *t
+			saved.size = size
+			if err := w.Write(&saved); err != nil {
+				log.Printf("writing truck %d: %v", t.id, err)
+			}
+		}
+		r.size = size
 		for pn, p := range t.pallets {
+			p.size = size
 			for _, b := range p.boxes {
 				if !a.boxOk(b) {
-					log.Printf("box %v in truck %d was not in the input", b.id, t.id)
-					r.fail = true
+					if a.wasRotated(b) {
+						r.failf(failRotated, "box %v in truck %d is locked, but was rotated", b.id, t.id)
+					} else {
+						r.failf(failNotInInput, "box %v in truck %d was not in the input", b.id, t.id)
+					}
 				}
 			}
 			if err := p.IsValid(); err == nil {
 				r.items += p.Items()
+				if size.maxWeight > 0 {
+					r.weight += p.Weight()
+					r.capacity += int(size.maxWeight)
+				}
 			} else {
-				log.Printf("pallet %v in truck %d is not correctly packed: %v", pn, t.id, err)
-				r.fail = true
+				r.failf(palletFailure(err), "pallet %v in truck %d is not correctly packed: %v", pn, t.id, err)
 			}
 		}
+		r.bound = boundPallets(size, truckBoxes(t))
 
 		// Calculate the profit (or loss!) of pallets.
 		a.trucksMu.Lock()
 		if _, ok := a.trucks[t.id]; ok {
-			r.profit = a.trucks[t.id] - len(t.pallets)
+			r.pallets = a.trucks[t.id]
+			r.profit = r.pallets - len(t.pallets)
+			r.elapsed = time.Since(a.arrived[t.id])
 		} else {
-			log.Printf("truck %v unknown", t.id)
-			r.fail = true
+			r.failf(failUnknownTruck, "truck %v unknown", t.id)
 		}
 		a.trucksMu.Unlock()
 
@@ -113,13 +212,15 @@ func process(doneTime time.Time, r io.Reader, a *accounting, resultChan chan res
 
 	a.boxesMu.Lock()
 	if len(a.boxes) != 0 {
-		log.Printf("%v boxes not seen in the departing trucks", len(a.boxes))
-		resultChan <- result{fail: true}
+		r := result{}
+		r.failf(failNotSeen, "%v boxes not seen in the departing trucks", len(a.boxes))
+		resultChan <- r
 	}
 	a.boxesMu.Unlock()
 }
 
 // boxOk checks if the box was in the input, and if so it deletes it from the map.
+// A locked box must also be the same way around as it was in the input.
 func (a *accounting) boxOk(b box) (ok bool) {
 	b0 := b.canon()
 	a.boxesMu.Lock()
@@ -131,49 +232,210 @@ func (a *accounting) boxOk(b box) (ok bool) {
 	return
 }
 
+// wasRotated checks if the box is locked, and was in the input the other way
+// around.
+func (a *accounting) wasRotated(b box) bool {
+	if !b.locked {
+		return false
+	}
+	b.w, b.l = b.l, b.w
+	a.boxesMu.Lock()
+	_, ok := a.boxes[b.canon()]
+	a.boxesMu.Unlock()
+	return ok
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		if err := renderMain(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "validate" {
+		ok, err := validateMain(os.Args[2:])
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+
 	limit := flag.Duration("limit", 2*time.Second, "How long to repack before stopping.")
 	ngen := flag.Int("generate", 0, "How many trucks to generate.")
 	seed := flag.Int("seed", 1337, "The seed to use for generation (optional).")
+	genPallets := flag.String("genpallets", "uniform:5-14", "How many pallets each generated truck has, as uniform:LOW-HIGH, weighted:N=W,... or histogram:N=COUNT,...")
+	genBoxes := flag.String("genboxes", "uniform:1-5", "How many boxes are tried on each generated pallet, as for -genpallets.")
+	genWidth := flag.String("genwidth", "", "The widths of generated boxes, as for -genpallets. Defaults to uniform up to the pallet's length.")
+	genLength := flag.String("genlength", "", "The lengths of generated boxes, as for -genpallets. Defaults to uniform up to the pallet's width.")
+	genShapes := flag.String("genshapes", "", "The shapes of generated boxes, as weighted:WxL=W,... or histogram:WxL=COUNT,..., instead of -genwidth and -genlength (optional).")
+	genBest := flag.String("genbest", "", "A file to save the generated scenario's best profit in, as JSON (optional).")
+	scenarioName := flag.String("scenario", "random", "The kind of trucks to generate: "+strings.Join(scenarioNames(), ", ")+". Only random uses the -gen flags.")
+	genLegal := flag.Bool("genlegal", false, "Place generated boxes where they fit, so that every generated pallet is correctly packed.")
+	optimize := flag.Bool("optimize", true, "Split boxes across each truck's pallets all at once, searching for better splits until each truck's time runs out. Use -optimize=false to fill one pallet at a time.")
+	packerName := flag.String("packer", defaultPacker, "The packing algorithm: "+strings.Join(packerNames(), ", ")+".")
+	palletDims := flag.String("pallet", defaultPalletSize.String(), "The size of each pallet, as WxL, or WxLxH to stack boxes in layers.")
+	maxWeight := flag.Uint("maxweight", 0, "The most the boxes on each pallet may weigh, or 0 for no limit.")
+	rulesFile := flag.String("rules", "", "A file of rules for which boxes can't share a pallet (optional).")
+	format := flag.String("format", formatAuto, "The format of the trucks read, or generated: "+strings.Join(formats, ", ")+".")
+	outFile := flag.String("out", "", "A file to save the repacked trucks in, in the -format given or text (optional).")
+	resultsFormat := flag.String("results", resultsText, "How to write the results of the run: text, or json.")
+	resultsFile := flag.String("resultsout", "", "A file to write the results to, instead of standard output (optional).")
+	lenient := flag.Bool("lenient", false, "Skip trucks that can't be read, and list them at the end, instead of stopping at the first one.")
+	reportFile := flag.String("report", "", "An HTML file to write a report of the run to, comparing each truck before and after (optional).")
 	flag.Parse()
 
+	if _, err := newTruckSource(strings.NewReader(""), *format); err != nil {
+		log.Fatal(err)
+	}
+	truckFormat = *format
+	lenientParsing = *lenient
+	if *resultsFormat != resultsText && *resultsFormat != resultsJSON {
+		log.Fatal(errFormat(*resultsFormat))
+	}
+
+	if *rulesFile != "" {
+		rs, err := loadRules(*rulesFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		palletRules = rs
+	}
+
+	size, err := palletSizeFromString(*palletDims)
+	if err != nil {
+		log.Fatal(err)
+	}
+	size.maxWeight = uint32(*maxWeight)
+	defaultPalletSize = size
+
 	// If asked to generate trucks, do that and then exit.
 	if *ngen > 0 {
-		generate(*ngen, *seed)
+		g := newGenerator(int64(*seed), size)
+		g.legal = *genLegal
+		for _, d := range []struct {
+			spec  string
+			dist  *dist
+			parse func(string) (dist, error)
+		}{
+			{*genPallets, &g.pallets, distFromString},
+			{*genBoxes, &g.boxes, distFromString},
+			{*genWidth, &g.widths, distFromString},
+			{*genLength, &g.lengths, distFromString},
+			{*genShapes, &g.shapes, shapeDistFromString},
+		} {
+			if d.spec == "" {
+				continue
+			}
+			dist, err := d.parse(d.spec)
+			if err != nil {
+				log.Fatal(err)
+			}
+			*d.dist = dist
+		}
+		if err := g.check(); err != nil {
+			log.Fatal(err)
+		}
+		best, err := g.writeScenario(os.Stdout, *scenarioName, *ngen, *format)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if best >= 0 {
+			log.Printf("scenario %s: the best profit is %d", *scenarioName, best)
+		}
+		if *genBest != "" {
+			sb := scenarioBest{Scenario: *scenarioName, Trucks: *ngen, Seed: int64(*seed), Pallet: size.String()}
+			if best >= 0 {
+				sb.BestProfit = &best
+			}
+			if err := writeScenarioBest(*genBest, sb); err != nil {
+				log.Fatal(err)
+			}
+		}
 		return
 	}
 
+	p, err := lookupPacker(*packerName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	packer = p
+	optimizeTrucks = *optimize
+
 	runtime.GOMAXPROCS(4)
 
+	// The repacker's debug output goes to standard output, so JSON results
+	// written there would be lost in it. It goes to standard error instead.
+	stdout := os.Stdout
+	if *resultsFormat == resultsJSON && *resultsFile == "" {
+		os.Stdout = os.Stderr
+	}
+
 	// This needs to be a local so that the functions in repack.go can't
 	// cheat and mess with it. :)
-	acc := &accounting{
-		trucks: make(map[int]int),
-		boxes:  make(map[box]bool),
+	acc := newAccounting()
+	var report *runReport
+	if *reportFile != "" {
+		acc.inbound = make(map[int][]pallet)
+		report = &runReport{}
+	}
+
+	// Where to save the repacked trucks.
+	var sink truckSink
+	if *outFile != "" {
+		f, err := os.Create(*outFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		s, _ := newTruckSink(f, *format)
+		sink = &sharedSink{sink: s}
 	}
 
 	profit := 0
 	trucks := 0
 	items := 0
+	weight, capacity := 0, 0
 	fail := false
+	// The pallets of the trucks that came back are compared with the
+	// bound for the boxes they shipped, and with the bound for all of the
+	// input.
+	var shipped boxesBound
+	var gaps []truckGap
+	palletsOut := 0
+	finalTimedOut := false
+	results := &runResults{}
 	resultChan := make(chan result)
 
-	// A goroutine to load trucks, repack them, check the results
-	// and send them back to us. This needs to be in a goroutine, so that it's
-	// behavior (blocking, taking a long time for certain repacks, etc)
-	// never prevents the final timeout from firing.
-	go process(time.Now().Add(*limit), os.Stdin, acc, resultChan)
-
 	// The final timeout is 2*limit, so that you have time to work on
 	// packing the final truck.
+	start := time.Now()
 	finalLimit := *limit + *limit
 	finalTimeout := time.After(finalLimit)
 
+	// A goroutine to load trucks, repack them, check the results
+	// and send them back to us. This needs to be in a goroutine, so that it's
+	// behavior (blocking, taking a long time for certain repacks, etc)
+	// never prevents the final timeout from firing.
+	go process(start.Add(*limit), start.Add(finalLimit), os.Stdin, acc, resultChan, sink)
+
 done:
 	for {
 		select {
 		case <-finalTimeout:
 			fmt.Println("final timeout")
+			finalTimedOut = true
+			// The trucks still being packed never leave, and their
+			// boxes are never delivered.
+			r := result{}
+			r.failf(failNotDelivered, "final timeout: not all trucks left, so some boxes were not delivered")
+			fail = true
+			results.add(r)
+			if report != nil {
+				report.add(r, nil)
+			}
 			break done
 		case r, open := <-resultChan:
 			if !open {
@@ -182,16 +444,95 @@ done:
 			trucks++
 			profit += r.profit
 			items += r.items
+			weight += r.weight
+			capacity += r.capacity
 			if r.fail {
 				fail = true
 			}
+			results.add(r)
+			if r.truck != nil {
+				shipped.add(r.size, truckBoxes(r.truck))
+				gaps = append(gaps, truckGap{id: r.truck.id, pallets: len(r.truck.pallets), bound: r.bound.pallets()})
+				palletsOut += len(r.truck.pallets)
+			}
+			if report != nil {
+				var inbound []pallet
+				if r.truck != nil {
+					acc.trucksMu.Lock()
+					inbound = acc.inbound[r.truck.id]
+					acc.trucksMu.Unlock()
+				}
+				report.add(r, inbound)
+			}
+		}
+	}
+
+	// After a final timeout trucks may still be coming back, but the saved
+	// ones must be finished before anything can exit.
+	if sink != nil {
+		if err := sink.Close(); err != nil {
+			log.Print("writing trucks: ", err)
+		}
+	}
+
+	if report != nil {
+		if err := writeReport(*reportFile, report); err != nil {
+			log.Print(err)
+		}
+	}
+
+	out := io.Writer(stdout)
+	if *resultsFile != "" {
+		f, err := os.Create(*resultsFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	acc.trucksMu.Lock()
+	skipped, timedOut := acc.skipped, acc.timedOut
+	lastSize := truck{size: acc.last.size()}.dims()
+	shippedBound, inputBound := shipped.bound(lastSize), acc.input.bound(lastSize)
+	acc.trucksMu.Unlock()
+
+	if *resultsFormat == resultsJSON {
+		results.OK = !fail
+		results.ElapsedMS = ms(time.Since(start))
+		results.Timeout = timedOut
+		results.FinalTimeout = finalTimedOut
+		results.skip(skipped)
+		results.bound(palletsOut, shippedBound, inputBound)
+		if err := results.write(out); err != nil {
+			log.Print(err)
 		}
 	}
 
 	if fail {
 		log.Fatal("Trucks were not repacked correctly.")
 	}
-	fmt.Println("trucks repacked:", trucks)
-	fmt.Println("items repacked:", items)
-	fmt.Println("profit:", profit)
+	if *resultsFormat == resultsJSON {
+		return
+	}
+	// The gaps come first, so that tail still shows the trucks, items and
+	// profit. There's one line per truck, so those go to standard error.
+	if err := writeGaps(os.Stderr, gaps); err != nil {
+		log.Print(err)
+	}
+	if err := writeTotalGaps(out, palletsOut, shippedBound, inputBound); err != nil {
+		log.Print(err)
+	}
+	fmt.Fprintln(out, "trucks repacked:", trucks)
+	fmt.Fprintln(out, "items repacked:", items)
+	fmt.Fprintln(out, "profit:", profit)
+	if capacity > 0 {
+		fmt.Fprintf(out, "weight utilization: %d of %d (%.1f%%)\n", weight, capacity, 100*float64(weight)/float64(capacity))
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintln(out, "trucks skipped:", len(skipped))
+		for _, e := range skipped {
+			fmt.Fprintln(out, "  ", e)
+		}
+	}
 }
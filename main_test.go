@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_accounting_boxOk(t *testing.T) {
+	a := &accounting{boxes: make(map[box]bool)}
+	in := []box{
+		{x: 1, y: 0, w: 1, l: 3, id: 101, locked: true},
+		{x: 0, y: 0, w: 1, l: 3, id: 102},
+	}
+	for _, b := range in {
+		a.boxes[b.canon()] = true
+	}
+
+	rotated := box{x: 0, y: 0, w: 3, l: 1, id: 101, locked: true}
+	if a.boxOk(rotated) {
+		t.Error("rotated locked box accepted")
+	}
+	if !a.wasRotated(rotated) {
+		t.Error("rotated locked box not noticed")
+	}
+	if !a.boxOk(box{x: 2, y: 1, w: 1, l: 3, id: 101, locked: true}) {
+		t.Error("moved locked box rejected")
+	}
+	if !a.boxOk(box{x: 0, y: 0, w: 3, l: 1, id: 102}) {
+		t.Error("rotated box rejected")
+	}
+	if len(a.boxes) != 0 {
+		t.Errorf("%d boxes left", len(a.boxes))
+	}
+}
+
+// repackAll runs the trucks in through process, with plenty of time, and
+// returns the results and the repacked trucks as text. The truck optimizer
+// would search until the time runs out, so it is left off.
+func repackAll(in io.Reader) ([]result, string) {
+	defer func(o bool) { optimizeTrucks = o }(optimizeTrucks)
+	optimizeTrucks = false
+	var out bytes.Buffer
+	results := make(chan result)
+	now := time.Now()
+	go process(now.Add(time.Minute), now.Add(2*time.Minute), in, newAccounting(), results, newTruckWriter(&out))
+	var rs []result
+	for r := range results {
+		rs = append(rs, r)
+	}
+	return rs, out.String()
+}
+
+func Test_process_out(t *testing.T) {
+	f, err := os.Open("testdata/10trucks.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	results, saved := repackAll(f)
+
+	// Every truck that left is saved, the last one and empty ones too,
+	// and reads back the same without being told the pallet size.
+	defer func(s palletSize) { defaultPalletSize = s }(defaultPalletSize)
+	defaultPalletSize = palletSize{w: 9, l: 9}
+	tr := newTruckReader(strings.NewReader(saved))
+	for _, r := range results {
+		if r.truck == nil {
+			continue
+		}
+		got, err := tr.Next()
+		if err != nil {
+			t.Fatalf("reading truck %d back: %v", r.truck.id, err)
+		}
+		if got.id != r.truck.id || got.dims() != r.size || len(got.pallets) != len(r.truck.pallets) {
+			t.Errorf("truck %d with %d pallets of %v read back as truck %d with %d pallets of %v",
+				r.truck.id, len(r.truck.pallets), r.size, got.id, len(got.pallets), got.dims())
+			continue
+		}
+		for pn, p := range got.pallets {
+			if p.OneLine() != r.truck.pallets[pn].OneLine() {
+				t.Errorf("truck %d pallet %d read back as %q", got.id, pn, p.OneLine())
+			}
+		}
+	}
+	if _, err := tr.Next(); err != io.EOF {
+		t.Errorf("more trucks saved than left: %v", err)
+	}
+
+	// And they can be repacked again, with the saved last truck leaving as
+	// the last truck, without losing count of any box.
+	defaultPalletSize = palletSize{w: 4, l: 4}
+	again, _ := repackAll(strings.NewReader(saved))
+	lastTrucks := 0
+	for _, r := range again {
+		if r.fail {
+			t.Errorf("repacking the saved trucks failed: %v", r.failures)
+		}
+		if r.truck == nil {
+			continue
+		}
+		if r.truck.id == idLastTruck {
+			lastTrucks++
+		}
+		// No truck leaves with fewer pallets than its boxes need.
+		if len(r.truck.pallets) < r.bound.pallets() {
+			t.Errorf("truck %d: %d pallets, but at least %d needed", r.truck.id, len(r.truck.pallets), r.bound.pallets())
+		}
+	}
+	if lastTrucks != 1 {
+		t.Errorf("%d last trucks", lastTrucks)
+	}
+}
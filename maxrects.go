@@ -0,0 +1,260 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// rect is an area on the pallet. It uses the same coordinate system as a
+// box: it covers x to x+l and y to y+w.
+type rect struct {
+	x, y uint8
+	w, l uint8
+}
+
+// contains returns true if r fully covers o.
+func (r rect) contains(o rect) bool {
+	return o.x >= r.x && o.y >= r.y &&
+		o.x+o.l <= r.x+r.l && o.y+o.w <= r.y+r.w
+}
+
+// intersects returns true if r and o share any area.
+func (r rect) intersects(o rect) bool {
+	return o.x < r.x+r.l && r.x < o.x+o.l &&
+		o.y < r.y+r.w && r.y < o.y+o.w
+}
+
+// boxRect returns the area covered by a placed box.
+func boxRect(b box) rect {
+	return rect{x: b.x, y: b.y, w: b.w, l: b.l}
+}
+
+// maxRectsHeuristic decides which free rectangle a box is placed in.
+type maxRectsHeuristic int
+
+const (
+	// Best Short Side Fit: minimize the shorter leftover side.
+	maxRectsBSSF maxRectsHeuristic = iota
+	// Best Area Fit: minimize the leftover area.
+	maxRectsBAF
+	// Bottom-Left: place the box as low, then as left, as possible.
+	maxRectsBL
+	// Contact Point: maximize the perimeter touching edges and boxes.
+	maxRectsCP
+)
+
+func (h maxRectsHeuristic) String() string {
+	switch h {
+	case maxRectsBSSF:
+		return "bssf"
+	case maxRectsBAF:
+		return "baf"
+	case maxRectsBL:
+		return "bl"
+	case maxRectsCP:
+		return "cp"
+	}
+	return fmt.Sprintf("maxRectsHeuristic(%d)", int(h))
+}
+
+// maxRects tracks the maximal free rectangles left on a pallet, as described
+// in section 5 of RectangleBinPack.pdf.
+type maxRects struct {
+	heuristic maxRectsHeuristic
+	size      palletSize
+	free      []rect
+	used      []rect
+}
+
+// newMaxRects initializes an empty pallet of the given size.
+func newMaxRects(size palletSize, h maxRectsHeuristic) *maxRects {
+	return &maxRects{
+		heuristic: h,
+		size:      size,
+		free:      []rect{palletRect(size)},
+	}
+}
+
+// palletRect returns the area covered by a whole pallet.
+func palletRect(size palletSize) rect {
+	return rect{x: 0, y: 0, w: size.l, l: size.w}
+}
+
+// score rates placing a box of size w by l at free rectangle f. Lower is
+// better. The second value breaks ties.
+func (m *maxRects) score(f rect, w, l uint8) (int, int) {
+	lw, ll := int(f.w)-int(w), int(f.l)-int(l)
+	short, long := lw, ll
+	if short > long {
+		short, long = long, short
+	}
+	switch m.heuristic {
+	case maxRectsBAF:
+		return int(f.w)*int(f.l) - int(w)*int(l), short
+	case maxRectsBL:
+		return int(f.x) + int(l), int(f.y)
+	case maxRectsCP:
+		return -m.contact(rect{x: f.x, y: f.y, w: w, l: l}), short
+	}
+	return short, long
+}
+
+// contact returns how much of the perimeter of r touches the pallet edges or
+// boxes that are already placed.
+func (m *maxRects) contact(r rect) (n int) {
+	if r.x == 0 || r.x+r.l == m.size.w {
+		n += int(r.w)
+	}
+	if r.y == 0 || r.y+r.w == m.size.l {
+		n += int(r.l)
+	}
+	for _, u := range m.used {
+		if u.x == r.x+r.l || u.x+u.l == r.x {
+			n += overlap(u.y, u.y+u.w, r.y, r.y+r.w)
+		}
+		if u.y == r.y+r.w || u.y+u.w == r.y {
+			n += overlap(u.x, u.x+u.l, r.x, r.x+r.l)
+		}
+	}
+	return
+}
+
+// overlap returns the length shared by the intervals [a0, a1) and [b0, b1).
+func overlap(a0, a1, b0, b1 uint8) int {
+	if a1 < b1 {
+		b1 = a1
+	}
+	if a0 > b0 {
+		b0 = a0
+	}
+	if b1 <= b0 {
+		return 0
+	}
+	return int(b1 - b0)
+}
+
+// find returns the best position for the box, trying both orientations. If
+// the box does not fit, ok is false.
+func (m *maxRects) find(b box) (best box, s1, s2 int, ok bool) {
+	for _, f := range m.free {
+		for _, rot := range []func(*box){upright, sideways} {
+			c := b
+			rot(&c)
+			if c.w > f.w || c.l > f.l {
+				continue
+			}
+			a, z := m.score(f, c.w, c.l)
+			if !ok || a < s1 || (a == s1 && z < s2) {
+				c.x, c.y = f.x, f.y
+				best, s1, s2, ok = c, a, z, true
+			}
+		}
+	}
+	return
+}
+
+// place marks the area of a placed box as used, splitting every free
+// rectangle it intersects.
+func (m *maxRects) place(b box) {
+	r := boxRect(b)
+	free := make([]rect, 0, len(m.free)+4)
+	for _, f := range m.free {
+		if !f.intersects(r) {
+			free = append(free, f)
+			continue
+		}
+		if r.x > f.x {
+			free = append(free, rect{x: f.x, y: f.y, w: f.w, l: r.x - f.x})
+		}
+		if r.x+r.l < f.x+f.l {
+			free = append(free, rect{x: r.x + r.l, y: f.y, w: f.w, l: f.x + f.l - r.x - r.l})
+		}
+		if r.y > f.y {
+			free = append(free, rect{x: f.x, y: f.y, w: r.y - f.y, l: f.l})
+		}
+		if r.y+r.w < f.y+f.w {
+			free = append(free, rect{x: f.x, y: r.y + r.w, w: f.y + f.w - r.y - r.w, l: f.l})
+		}
+	}
+	m.free = prune(free)
+	m.used = append(m.used, r)
+}
+
+// prune removes any free rectangle that is contained by another.
+func prune(free []rect) []rect {
+	out := free[:0]
+	for i, f := range free {
+		keep := true
+		for j, o := range free {
+			if i == j {
+				continue
+			}
+			// Of two identical rectangles, keep the first.
+			if o.contains(f) && (f != o || j < i) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// maxRectsPacker returns a Packer that uses the MaxRects algorithm with the
+// given heuristic.
+func maxRectsPacker(h maxRectsHeuristic) Packer {
+	return PackerFunc(func(pal *pallet, boxes []box) []box {
+		return packWithMaxRectsHeuristic(pal, boxes, h)
+	})
+}
+
+// packWithMaxRects fills a pallet with the MaxRects algorithm using the Best
+// Short Side Fit heuristic. It returns the boxes that were not put onto the
+// pallet.
+func packWithMaxRects(pal *pallet, boxes []box) []box {
+	return packWithMaxRectsHeuristic(pal, boxes, maxRectsBSSF)
+}
+
+// packWithMaxRectsHeuristic fills a pallet by repeatedly placing the box that
+// scores best on any free rectangle (the "global best" variant). Bigger boxes
+// are preferred when scores tie.
+func packWithMaxRectsHeuristic(pal *pallet, boxes []box, h maxRectsHeuristic) []box {
+	m := newMaxRects(pal.dims(), h)
+
+	remaining := make([]box, len(boxes))
+	copy(remaining, boxes)
+	sort.Stable(byArea(remaining))
+
+	for len(remaining) > 0 {
+		bi := -1
+		var best box
+		var s1, s2 int
+		for i, b := range remaining {
+			c, a, z, ok := m.find(b)
+			if ok && (bi < 0 || a < s1 || (a == s1 && z < s2)) {
+				bi, best, s1, s2 = i, c, a, z
+			}
+		}
+		if bi < 0 {
+			break
+		}
+		if debug {
+			fmt.Printf("  + maxrects(%s) box %v\n", h, best)
+		}
+		m.place(best)
+		pal.boxes = append(pal.boxes, best)
+		remaining = append(remaining[:bi], remaining[bi+1:]...)
+	}
+	return remaining
+}
+
+// byArea sorts boxes with the largest area first.
+type byArea []box
+
+func (boxes byArea) Len() int { return len(boxes) }
+func (boxes byArea) Less(i, j int) bool {
+	return int(boxes[i].w)*int(boxes[i].l) > int(boxes[j].w)*int(boxes[j].l)
+}
+func (boxes byArea) Swap(i, j int) { boxes[i], boxes[j] = boxes[j], boxes[i] }
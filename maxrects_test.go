@@ -0,0 +1,56 @@
+package main
+
+import "testing"
+
+func Test_prune(t *testing.T) {
+	free := []rect{
+		{0, 0, 4, 4},
+		{0, 0, 2, 2},
+		{1, 1, 1, 1},
+		{0, 0, 4, 4},
+	}
+	got := prune(free)
+	if len(got) != 1 || got[0] != (rect{0, 0, 4, 4}) {
+		t.Errorf("got %v, want one 4x4 rect", got)
+	}
+}
+
+func Test_maxRects_place(t *testing.T) {
+	m := newMaxRects(palletSize{w: 4, l: 4}, maxRectsBSSF)
+	m.place(box{x: 0, y: 0, w: 2, l: 2, id: 99})
+	want := []rect{
+		{2, 0, 4, 2},
+		{0, 2, 2, 4},
+	}
+	if len(m.free) != len(want) {
+		t.Fatalf("got %v, want %v", m.free, want)
+	}
+	for i := range want {
+		if m.free[i] != want[i] {
+			t.Errorf("%d: got %v, want %v", i, m.free[i], want[i])
+		}
+	}
+}
+
+func Test_packWithMaxRects(t *testing.T) {
+	for _, h := range []maxRectsHeuristic{maxRectsBSSF, maxRectsBAF, maxRectsBL, maxRectsCP} {
+		// These tile the pallet exactly.
+		boxes := []box{
+			{x: 0, y: 0, w: 3, l: 1, id: 90},
+			{x: 0, y: 0, w: 1, l: 3, id: 91},
+			{x: 0, y: 0, w: 3, l: 3, id: 92},
+			{x: 0, y: 0, w: 1, l: 1, id: 93},
+		}
+		pal := &pallet{}
+		unused := packWithMaxRectsHeuristic(pal, boxes, h)
+		if err := pal.IsValid(); err != nil {
+			t.Errorf("%s: pallet is not packed correctly: %s", h, err)
+		}
+		if got, want := len(pal.boxes)+len(unused), len(boxes); got != want {
+			t.Errorf("%s: got %d boxes back, want %d", h, got, want)
+		}
+		if h == maxRectsBSSF && len(unused) != 0 {
+			t.Errorf("%s: got %d unused boxes, want 0%s", h, len(unused), pal)
+		}
+	}
+}
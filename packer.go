@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// A Packer places boxes onto a pallet. It appends the boxes it places to
+// pal.boxes, with their position and orientation set, and returns the boxes
+// that were not put onto the pallet.
+//
+// Every packer must leave the pallet valid according to pallet.IsValid, and
+// every box given must come back exactly once, either on the pallet or in
+// the returned slice.
+type Packer interface {
+	Pack(pal *pallet, boxes []box) []box
+}
+
+// PackerFunc adapts an ordinary function to the Packer interface.
+type PackerFunc func(pal *pallet, boxes []box) []box
+
+// Pack calls f(pal, boxes).
+func (f PackerFunc) Pack(pal *pallet, boxes []box) []box {
+	return f(pal, boxes)
+}
+
+// defaultPacker is the name of the packer used when none is chosen.
+const defaultPacker = "shelves"
+
+var (
+	packersMu sync.RWMutex
+	packers   = make(map[string]Packer)
+)
+
+// registerPacker makes a packer available by name. It panics if the name is
+// already taken.
+func registerPacker(name string, p Packer) {
+	packersMu.Lock()
+	defer packersMu.Unlock()
+	if _, dup := packers[name]; dup {
+		panic("registerPacker called twice for " + name)
+	}
+	packers[name] = p
+}
+
+// lookupPacker returns the packer registered under name.
+func lookupPacker(name string) (Packer, error) {
+	packersMu.RLock()
+	defer packersMu.RUnlock()
+	p, ok := packers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown packer %q", name)
+	}
+	return p, nil
+}
+
+// packerNames returns the names of all registered packers, sorted.
+func packerNames() []string {
+	packersMu.RLock()
+	defer packersMu.RUnlock()
+	names := make([]string, 0, len(packers))
+	for name := range packers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	registerPacker("shelves", PackerFunc(packWithShelves))
+	registerPacker("maxrects", PackerFunc(packWithMaxRects))
+	registerPacker("maxrects-baf", maxRectsPacker(maxRectsBAF))
+	registerPacker("maxrects-bl", maxRectsPacker(maxRectsBL))
+	registerPacker("maxrects-cp", maxRectsPacker(maxRectsCP))
+	registerPacker("exact", exactPacker(exactMostCells))
+	registerPacker("exact-boxes", exactPacker(exactMostBoxes))
+	registerPacker("guillotine", PackerFunc(packWithGuillotine))
+	registerPacker("guillotine-nomerge", guillotinePacker(guillotineBAF, guillotineSLAS, false))
+	registerPacker("skyline", PackerFunc(packWithSkyline))
+	registerPacker("skyline-nomap", skylinePacker(skylineBL, false))
+	registerPacker("skyline-minwaste", skylinePacker(skylineMinWaste, true))
+	registerPacker("skyline-minwaste-nomap", skylinePacker(skylineMinWaste, false))
+	for _, c := range guillotineChoices {
+		for _, s := range guillotineSplits {
+			name := fmt.Sprintf("guillotine-%s-%s", c, s)
+			registerPacker(name, guillotinePacker(c, s, true))
+		}
+	}
+
+	// Portfolios race packers that are already registered.
+	p, err := newPortfolio("shelves", "maxrects", "exact")
+	if err != nil {
+		panic(err)
+	}
+	registerPacker("portfolio", p)
+	p, err = newPortfolio("maxrects", "maxrects-baf", "maxrects-bl", "maxrects-cp", "guillotine", "skyline", "skyline-minwaste", "exact")
+	if err != nil {
+		panic(err)
+	}
+	registerPacker("portfolio-wide", p)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// conformanceSets are box sets that every packer is checked against.
+func conformanceSets() [][]box {
+	sets := [][]box{
+		{},
+		{{x: 0, y: 0, w: 4, l: 4, id: 1}},
+		{{x: 0, y: 0, w: 1, l: 1, id: 1}, {x: 0, y: 0, w: 1, l: 1, id: 2}, {x: 0, y: 0, w: 1, l: 1, id: 3}},
+		{{x: 0, y: 0, w: 3, l: 1, id: 1}, {x: 0, y: 0, w: 1, l: 3, id: 2}, {x: 0, y: 0, w: 3, l: 3, id: 3}, {x: 0, y: 0, w: 1, l: 1, id: 4}},
+		{{x: 2, y: 2, w: 4, l: 3, id: 1}, {x: 1, y: 1, w: 2, l: 3, id: 2}, {x: 3, y: 0, w: 1, l: 4, id: 3}, {x: 0, y: 0, w: 2, l: 2, id: 4}},
+	}
+	r := rand.New(rand.NewSource(1))
+	id := uint32(100)
+	for i := 0; i < 50; i++ {
+		set := make([]box, r.Intn(30))
+		for j := range set {
+			set[j] = box{
+				x:  uint8(r.Intn(4)),
+				y:  uint8(r.Intn(4)),
+				w:  uint8(r.Intn(6) + 1),
+				l:  uint8(r.Intn(6) + 1),
+				id: id,
+			}
+			id++
+		}
+		sets = append(sets, set)
+	}
+
+	// Some boxes that may not be rotated.
+	sets = append(sets, []box{
+		{w: 1, l: 4, id: 1, locked: true},
+		{w: 4, l: 1, id: 2, locked: true},
+		{w: 3, l: 2, id: 3, locked: true},
+		{w: 2, l: 3, id: 4},
+	})
+	for i := 0; i < 20; i++ {
+		set := make([]box, r.Intn(20))
+		for j := range set {
+			set[j] = box{
+				w:      uint8(r.Intn(6) + 1),
+				l:      uint8(r.Intn(6) + 1),
+				id:     id,
+				locked: r.Intn(2) == 0,
+			}
+			id++
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+// conformanceSizes are the pallet sizes every packer is checked on.
+var conformanceSizes = []palletSize{{w: 4, l: 4}, {w: 4, l: 6}, {w: 6, l: 3}, {w: 1, l: 5}}
+
+// TestPackerConformance checks that every registered packer produces valid
+// pallets and accounts for every box it was given.
+func TestPackerConformance(t *testing.T) {
+	for _, name := range packerNames() {
+		p, err := lookupPacker(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, size := range conformanceSizes {
+			checkConformance(t, name, p, size, conformanceSets())
+		}
+	}
+}
+
+func checkConformance(t *testing.T, name string, p Packer, size palletSize, sets [][]box) {
+	name = name + " " + size.String()
+	for i, set := range sets {
+		in := make([]box, len(set))
+		copy(in, set)
+
+		pal := newPallet(size)
+		unused := p.Pack(pal, in)
+		if err := pal.IsValid(); err != nil {
+			t.Errorf("%s: set %d: %v%s", name, i, err, pal)
+		}
+
+		seen := make(map[uint32]box)
+		for _, b := range append(pal.boxes, unused...) {
+			if _, dup := seen[b.id]; dup {
+				t.Errorf("%s: set %d: box %d returned twice", name, i, b.id)
+			}
+			seen[b.id] = b
+		}
+		for _, b := range set {
+			got, ok := seen[b.id]
+			if !ok {
+				t.Errorf("%s: set %d: box %d lost", name, i, b.id)
+				continue
+			}
+			if got.canon() != b.canon() {
+				t.Errorf("%s: set %d: box %v changed size to %v", name, i, b, got)
+			}
+		}
+		if len(seen) != len(set) {
+			t.Errorf("%s: set %d: got %d boxes back, want %d", name, i, len(seen), len(set))
+		}
+	}
+}
+
+// conformanceWrappers are checked around every registered packer. Each gives
+// the boxes the attributes it cares about, and packs them on a pallet that
+// uses them.
+var conformanceWrappers = []struct {
+	name  string
+	wrap  func(Packer) Packer
+	size  palletSize
+	rules *ruleSet
+	attrs func(r *rand.Rand, b *box)
+}{
+	{
+		name:  "stacked",
+		wrap:  stacked,
+		size:  palletSize{w: 4, l: 4, h: 3},
+		attrs: func(r *rand.Rand, b *box) { b.h = uint8(r.Intn(4)) },
+	},
+	{
+		name:  "under weight",
+		wrap:  underWeight,
+		size:  palletSize{w: 4, l: 4, maxWeight: 30},
+		attrs: func(r *rand.Rand, b *box) { b.weight = uint32(r.Intn(20)) },
+	},
+	{
+		name:  "by rules",
+		wrap:  func(p Packer) Packer { return byRules(conformanceRules, p) },
+		size:  palletSize{w: 4, l: 4},
+		rules: conformanceRules,
+		attrs: func(r *rand.Rand, b *box) {
+			b.hazard = uint8(r.Intn(3))
+			b.temp = uint8(r.Intn(2))
+		},
+	},
+}
+
+// conformanceRules are followed by the "by rules" conformance wrapper.
+var conformanceRules = &ruleSet{rules: []rule{
+	{attr: "hazard", a: 1, b: 2},
+	{attr: "hazard", a: 1, b: 0},
+	{attr: "temp", a: 1, b: 0},
+}}
+
+// TestWrapperConformance checks that every registered packer, inside each of
+// the wrappers, produces valid pallets and accounts for every box it was
+// given.
+func TestWrapperConformance(t *testing.T) {
+	defer func(rs *ruleSet) { palletRules = rs }(palletRules)
+	for _, w := range conformanceWrappers {
+		palletRules = &ruleSet{}
+		if w.rules != nil {
+			palletRules = w.rules
+		}
+		r := rand.New(rand.NewSource(1))
+		sets := conformanceSets()
+		for _, set := range sets {
+			for j := range set {
+				w.attrs(r, &set[j])
+			}
+		}
+		for _, name := range packerNames() {
+			p, err := lookupPacker(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkConformance(t, w.name+" "+name, w.wrap(p), w.size, sets)
+		}
+	}
+}
+
+func TestLookupPacker(t *testing.T) {
+	if _, err := lookupPacker(defaultPacker); err != nil {
+		t.Error(err)
+	}
+	if _, err := lookupPacker("nope"); err == nil {
+		t.Error("missing error for unknown packer")
+	}
+}
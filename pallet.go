@@ -5,40 +5,221 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 )
 
 // A pallet holds a collections of boxes, each in a certain place on a grid.
+// A pallet with no size set has the default size.
 type pallet struct {
 	boxes []box
+	size  palletSize
 }
 
-const palletWidth = 4
-const palletLength = 4
+// A palletSize is the footprint of a pallet, and how high it may be stacked.
+// Boxes run from x to x+l across the width, from y to y+w along the length,
+// and from z to z+h up from the deck. A pallet with no height set takes one
+// layer of boxes.
+type palletSize struct {
+	w, l, h uint8
+	// maxWeight is the most the boxes on the pallet may weigh together.
+	// Zero means there is no limit.
+	maxWeight uint32
+}
+
+// defaultPalletSize is the size of pallets that don't say otherwise. It can
+// be changed on the command line.
+var defaultPalletSize = palletSize{w: 4, l: 4}
+
+// newPallet returns an empty pallet of the given size.
+func newPallet(size palletSize) *pallet {
+	return &pallet{boxes: make([]box, 0, size.cells()), size: size}
+}
+
+// cells is the number of grid squares on the pallet.
+func (s palletSize) cells() int { return int(s.w) * int(s.l) }
+
+// height is how many layers of boxes the pallet takes.
+func (s palletSize) height() int {
+	if s.h == 0 {
+		return 1
+	}
+	return int(s.h)
+}
+
+// volume is the number of grid cubes on the pallet.
+func (s palletSize) volume() int { return s.cells() * s.height() }
+
+// fits returns true if a box of size w by l fits without being rotated.
+func (s palletSize) fits(w, l uint8) bool { return l <= s.w && w <= s.l }
+
+// holds returns true if the box fits, rotated if it may be.
+func (s palletSize) holds(b box) bool {
+	return s.fits(b.w, b.l) || (!b.locked && s.fits(b.l, b.w))
+}
+
+// A lastSize picks the pallet size of the last truck, which takes the boxes
+// left over from trucks of every size. It is the biggest size that arrived
+// which holds every box, or just the biggest if none does.
+type lastSize struct {
+	sizes []palletSize
+	// turned is as long and as wide as the biggest boxes that may be
+	// turned, and locked as the biggest boxes that may not.
+	turned, locked box
+	// height and weight are of the tallest and the heaviest box.
+	height int
+	weight uint32
+}
+
+// add counts the truck's pallet size and boxes.
+func (ls *lastSize) add(t *truck) {
+	size := t.dims()
+	seen := false
+	for _, s := range ls.sizes {
+		seen = seen || s == size
+	}
+	if !seen {
+		ls.sizes = append(ls.sizes, size)
+	}
+	for _, p := range t.pallets {
+		for _, b := range p.boxes {
+			c := b.canon()
+			need := &ls.turned
+			if c.locked {
+				need = &ls.locked
+				need.locked = true
+			}
+			need.w = maxUint8(need.w, c.w)
+			need.l = maxUint8(need.l, c.l)
+			if c.height() > ls.height {
+				ls.height = c.height()
+			}
+			if c.weight > ls.weight {
+				ls.weight = c.weight
+			}
+		}
+	}
+}
+
+// holdsAll returns true if every box counted fits on pallets of the size.
+func (ls *lastSize) holdsAll(size palletSize) bool {
+	if ls.height > size.height() || size.maxWeight != 0 && ls.weight > size.maxWeight {
+		return false
+	}
+	return size.holds(ls.turned) && size.holds(ls.locked)
+}
+
+// size returns the pallet size for the last truck. It is the zero size if
+// no trucks were counted. Of sizes with the same volume, the first to
+// arrive wins.
+func (ls *lastSize) size() palletSize {
+	var biggest, holding palletSize
+	for _, s := range ls.sizes {
+		if s.volume() > biggest.volume() {
+			biggest = s
+		}
+		if ls.holdsAll(s) && s.volume() > holding.volume() {
+			holding = s
+		}
+	}
+	if holding != (palletSize{}) {
+		return holding
+	}
+	return biggest
+}
+
+// maxUint8 returns the bigger of a and b.
+func maxUint8(a, b uint8) uint8 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func (s palletSize) String() string {
+	if s.height() > 1 {
+		return fmt.Sprintf("%dx%dx%d", s.w, s.l, s.h)
+	}
+	return fmt.Sprintf("%dx%d", s.w, s.l)
+}
+
+var errPalletSize = errors.New("pallet size must look like 4x4, or 4x4x2 with a height")
+
+// palletSizeFromString reads a pallet size of the form "WxL" or "WxLxH".
+func palletSizeFromString(in string) (s palletSize, err error) {
+	f := strings.Split(in, "x")
+	if len(f) < 2 || len(f) > 3 {
+		return palletSize{}, errPalletSize
+	}
+	var dims [3]uint8
+	for i, d := range f {
+		n, err := strconv.ParseUint(d, 10, 8)
+		if err != nil || n == 0 {
+			return palletSize{}, errPalletSize
+		}
+		dims[i] = uint8(n)
+	}
+	return palletSize{w: dims[0], l: dims[1], h: dims[2]}, nil
+}
+
+// dims returns the size of the pallet.
+func (p pallet) dims() palletSize {
+	if p.size == (palletSize{}) {
+		return defaultPalletSize
+	}
+	return p.size
+}
 
 // palletFromString reads a pallet from a string. A pallet is a comma-separated
 // list of boxes.
 func palletFromString(in string) (pallet, error) {
+	p, _, err := palletFromStringAt(in)
+	return p, err
+}
+
+// palletFromStringAt reads a pallet like palletFromString. If a box can't be
+// read, it also returns the column the box starts at, counting from 1.
+func palletFromStringAt(in string) (pallet, int, error) {
 	p := pallet{}
 
+	col := 1
 	boxes := strings.Split(in, ",")
 	for _, s := range boxes {
 		b, err := boxFromString(s)
 		if err != nil {
-			return pallet{}, err
+			return pallet{}, col, err
 		}
 		p.boxes = append(p.boxes, b)
+		col += len(s) + 1
 	}
-	return p, nil
+	return p, 0, nil
 }
 
 func (p pallet) Items() int { return len(p.boxes) }
 
+// Weight is how much all the boxes on the pallet weigh.
+func (p pallet) Weight() (weight int) {
+	for _, b := range p.boxes {
+		weight += int(b.weight)
+	}
+	return
+}
+
+// Volume is how much space all the boxes on the pallet take up.
+func (p pallet) Volume() (volume int) {
+	for _, b := range p.boxes {
+		volume += b.volume()
+	}
+	return
+}
+
 // IsValid returns nil if the pallet is correctly packed, otherwise an error
-// that indicates the problem.
+// that indicates the problem. The boxes must also follow palletRules.
 func (p pallet) IsValid() error {
-	_, err := p.paint()
-	return err
+	if _, err := p.paint(); err != nil {
+		return err
+	}
+	return palletRules.check(p.boxes)
 }
 
 var emptybox = box{}
@@ -47,34 +228,87 @@ var emptybox = box{}
 // and attempts to put them onto a palletgrid. If a box overlaps
 // another, it continues painting and returns an error. If a
 // box falls outside the pallet it is truncated and an error
-// is returned.
+// is returned. Once every box is painted, each one that isn't
+// on the deck must rest fully on the boxes beneath it.
 func (p pallet) paint() (g palletgrid, err error) {
+	g = newPalletgrid(p.dims())
+	weight := 0
 	for bn, b := range p.boxes {
-		for i := b.x; i < b.x+b.l; i++ {
-			for j := b.y; j < b.y+b.w; j++ {
-				ok := true
-
-				// Out of bounds?
-				if i >= palletWidth || j >= palletLength {
-					err = errEdge(bn)
-					ok = false
-					continue
-				}
+		// Too heavy?
+		weight += int(b.weight)
+		if g.size.maxWeight > 0 && weight > int(g.size.maxWeight) {
+			err = errOverweight(bn)
+		}
 
-				// Was this spot already painted?
-				if g[i*palletLength+j] != emptybox {
-					err = errOverlap(bn)
-					ok = false
-				}
-				if ok {
-					g[i*palletLength+j] = b
+		for k := int(b.z); k < int(b.z)+b.height(); k++ {
+			for i := int(b.x); i < int(b.x)+int(b.l); i++ {
+				for j := int(b.y); j < int(b.y)+int(b.w); j++ {
+					ok := true
+
+					// Out of bounds?
+					if i >= int(g.size.w) || j >= int(g.size.l) || k >= g.size.height() {
+						err = errEdge(bn)
+						ok = false
+						continue
+					}
+
+					// Was this spot already painted?
+					if g.atz(i, j, k) != emptybox {
+						err = errOverlap(bn)
+						ok = false
+					}
+					if ok {
+						g.cells[g.index(i, j, k)] = b
+					}
 				}
 			}
 		}
 	}
+	for bn, b := range p.boxes {
+		if b.z == 0 {
+			continue
+		}
+		if !g.supported(b) {
+			err = errFloating(bn)
+		} else if g.onFragile(b) {
+			err = errCrushed(bn)
+		}
+	}
 	return
 }
 
+// supported returns true if every cell under the box is taken.
+func (g palletgrid) supported(b box) bool {
+	k := int(b.z) - 1
+	if k >= g.size.height() {
+		return false
+	}
+	for i := int(b.x); i < int(b.x)+int(b.l) && i < int(g.size.w); i++ {
+		for j := int(b.y); j < int(b.y)+int(b.w) && j < int(g.size.l); j++ {
+			if g.atz(i, j, k) == emptybox {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// onFragile returns true if any of the boxes under the box is fragile.
+func (g palletgrid) onFragile(b box) bool {
+	k := int(b.z) - 1
+	if k >= g.size.height() {
+		return false
+	}
+	for i := int(b.x); i < int(b.x)+int(b.l) && i < int(g.size.w); i++ {
+		for j := int(b.y); j < int(b.y)+int(b.w) && j < int(g.size.l); j++ {
+			if g.atz(i, j, k).fragile {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 type errOverlap int
 
 func (e errOverlap) Error() string {
@@ -87,31 +321,60 @@ func (e errEdge) Error() string {
 	return fmt.Sprintf("box %v goes off the edge", int(e))
 }
 
+type errOverweight int
+
+func (e errOverweight) Error() string {
+	return fmt.Sprintf("box %v takes the pallet over its weight limit", int(e))
+}
+
+type errCrushed int
+
+func (e errCrushed) Error() string {
+	return fmt.Sprintf("box %v is stacked on a fragile box", int(e))
+}
+
+type errFloating int
+
+func (e errFloating) Error() string {
+	return fmt.Sprintf("box %v is not resting on the boxes below it", int(e))
+}
+
 var errEmpty = errors.New("empty box")
 var errZeroBox = errors.New("zero-sized box")
 
+// errShortBox is what a reader reports for a box line that ends too soon.
+// boxFromString returns io.EOF for it, which would look like the end of the
+// input.
+var errShortBox = errors.New("box needs x, y, w, l and id")
+
 const symbols = "!@#$%^&*-=+:<>?x"
 
 func (p pallet) String() (out string) {
 	// Pick a symbol to represent each box
 	tochar := make(map[box]string)
 	for i, x := range p.boxes {
-		tochar[x] = string(symbols[i])
+		tochar[x] = string(symbols[i%len(symbols)])
 	}
 
+	// Layers are drawn from the deck up, with a blank line between them.
 	pg, _ := p.paint()
 	out = "\n"
-	for i := 0; i < palletWidth; i++ {
-		out += "| "
-		for j := 0; j < palletLength; j++ {
-			b := pg[i*palletLength+j]
-			if b == emptybox {
-				out += "  "
-			} else {
-				out += fmt.Sprintf("%s ", tochar[b])
+	for k := 0; k < pg.size.height(); k++ {
+		if k > 0 {
+			out += "\n"
+		}
+		for i := 0; i < int(pg.size.w); i++ {
+			out += "| "
+			for j := 0; j < int(pg.size.l); j++ {
+				b := pg.atz(i, j, k)
+				if b == emptybox {
+					out += "  "
+				} else {
+					out += fmt.Sprintf("%s ", tochar[b])
+				}
 			}
+			out += "|\n"
 		}
-		out += "|\n"
 	}
 	return
 }
@@ -125,72 +388,295 @@ func (p pallet) OneLine() string {
 	return strings.Join(out, ",")
 }
 
-type palletgrid [16]box
+// A palletgrid is the box covering each cube of a pallet, or emptybox.
+type palletgrid struct {
+	size  palletSize
+	cells []box
+}
+
+func newPalletgrid(size palletSize) palletgrid {
+	return palletgrid{size: size, cells: make([]box, size.volume())}
+}
+
+// index returns where the cube at x, y, z is kept in cells.
+func (g palletgrid) index(x, y, z int) int {
+	return (z*int(g.size.w)+x)*int(g.size.l) + y
+}
+
+// at returns the box on the deck at x, y.
+func (g palletgrid) at(x, y int) box {
+	return g.atz(x, y, 0)
+}
+
+// atz returns the box at x, y, z.
+func (g palletgrid) atz(x, y, z int) box {
+	return g.cells[g.index(x, y, z)]
+}
 
 // A box is a box, including its position on the pallet. Its
-// ID is unique across all the boxes in one input file.
+// ID is unique across all the boxes in one input file. A box
+// with no height set is one layer tall, and one with no weight
+// set weighs nothing. A locked box must keep the orientation
+// it came in with, and nothing may be stacked on a fragile box.
 type box struct {
-	x, y uint8
-	w, l uint8
-	id   uint32
+	x, y, z uint8
+	w, l, h uint8
+	id      uint32
+	weight  uint32
+	locked  bool
+	fragile bool
+	// hazard is the box's hazardous goods class, and temp its temperature
+	// zone. Zero is none, and ambient.
+	hazard, temp uint8
+}
+
+// height is how many layers the box takes up.
+func (b box) height() int {
+	if b.h == 0 {
+		return 1
+	}
+	return int(b.h)
 }
 
+// volume is the number of grid cubes the box takes up.
+func (b box) volume() int { return int(b.w) * int(b.l) * b.height() }
+
 func (b box) String() string {
-	return fmt.Sprintf("%v %v %v %v %v", b.x, b.y, b.w, b.l, b.id)
+	out := fmt.Sprintf("%v %v %v %v %v", b.x, b.y, b.w, b.l, b.id)
+	if b.weight > 0 {
+		out += fmt.Sprintf(" %v", b.weight)
+	}
+	if b.z > 0 {
+		out += fmt.Sprintf(" z=%v", b.z)
+	}
+	if b.height() > 1 {
+		out += fmt.Sprintf(" h=%v", b.h)
+	}
+	if b.locked {
+		out += " lock=1"
+	}
+	if b.fragile {
+		out += " fragile=1"
+	}
+	if b.hazard > 0 {
+		out += fmt.Sprintf(" hazard=%v", b.hazard)
+	}
+	if b.temp > 0 {
+		out += fmt.Sprintf(" temp=%v", b.temp)
+	}
+	return out
 }
 
 // canon makes a canonicalized form of the box for use
 // as the key in a map. The position is zeroed, and the orientation
-// of the box is "horizontal" (i.e. width > length).
+// of the box is "horizontal" (i.e. width > length), unless the box
+// is locked.
 func (b box) canon() (out box) {
 	out = b
-	out.x, out.y = 0, 0
-	if out.w < out.l {
+	out.x, out.y, out.z = 0, 0, 0
+	out.h = uint8(b.height())
+	if out.w < out.l && !out.locked {
 		out.l, out.w = out.w, out.l
 	}
 	return
 }
 
-// boxFromString returns the box defined by a string of the form "x y w h id".
+// boxFromString returns the box defined by a string of the form "x y w h id",
+// or "x y w h id weight". It may be followed by attributes of the form
+// "name=value":
+//
+//	z=1 h=2   the box sits one layer up, and is two layers tall
+//	lock=1    the box may not be rotated
+//	fragile=1 nothing may be stacked on the box
+//	hazard=3  the box holds class 3 hazardous goods
+//	temp=1    the box travels in temperature zone 1
 func boxFromString(in string) (b box, err error) {
-	_, err = fmt.Sscanln(in, &b.x, &b.y, &b.w, &b.l, &b.id)
+	in, attrs := splitAttrs(in)
+	if len(strings.Fields(in)) == 6 {
+		_, err = fmt.Sscanln(in, &b.x, &b.y, &b.w, &b.l, &b.id, &b.weight)
+	} else {
+		_, err = fmt.Sscanln(in, &b.x, &b.y, &b.w, &b.l, &b.id)
+	}
 	if b == emptybox {
 		return b, errEmpty
 	}
 	if b.w == 0 && b.l == 0 {
 		return b, errZeroBox
 	}
+	if err != nil {
+		return
+	}
+	for _, a := range attrs {
+		if err = b.setAttr(a); err != nil {
+			return
+		}
+	}
 	return
 }
 
+// splitAttrs splits the "name=value" attributes off the end of a box.
+func splitAttrs(in string) (string, []string) {
+	f := strings.Fields(in)
+	n := len(f)
+	for n > 0 && strings.Contains(f[n-1], "=") {
+		n--
+	}
+	if n == len(f) {
+		return in, nil
+	}
+	return strings.Join(f[:n], " "), f[n:]
+}
+
+// errBoxAttr is returned for a box attribute that can't be read.
+type errBoxAttr string
+
+func (e errBoxAttr) Error() string {
+	return fmt.Sprintf("bad box attribute %q", string(e))
+}
+
+// setAttr sets one "name=value" attribute of the box.
+func (b *box) setAttr(a string) error {
+	kv := strings.SplitN(a, "=", 2)
+	n, err := strconv.ParseUint(kv[1], 10, 8)
+	if err != nil {
+		return errBoxAttr(a)
+	}
+	switch kv[0] {
+	case "z":
+		b.z = uint8(n)
+	case "h":
+		if n == 0 {
+			return errZeroBox
+		}
+		b.h = uint8(n)
+	case "lock":
+		if n > 1 {
+			return errBoxAttr(a)
+		}
+		b.locked = n == 1
+	case "fragile":
+		if n > 1 {
+			return errBoxAttr(a)
+		}
+		b.fragile = n == 1
+	case "hazard":
+		b.hazard = uint8(n)
+	case "temp":
+		b.temp = uint8(n)
+	default:
+		return errBoxAttr(a)
+	}
+	return nil
+}
+
 // A truckReader scans an io.Reader, returning the trucks parsed from the input.
 //
 // A truck starts with "truck <id>", and ends with "endtruck". Inside of a truck,
-// there's one pallet per line.
+// there's one pallet per line. The header may also give the size of the
+// truck's pallets and how much each may carry, as in
+// "truck 7 pallet=4x6 maxweight=500".
 type truckReader struct {
-	scn *bufio.Scanner
-	err error
+	scn  *bufio.Scanner
+	err  error
+	line int
+	// lenient readers skip trucks that can't be read, and keep the errors
+	// in skipped.
+	lenient bool
+	skipped []*ParseError
 }
 
+// lenientParsing makes trucks that can't be read be skipped, instead of
+// stopping the input. It can be changed on the command line.
+var lenientParsing = false
+
+// A ParseError is a line of a truck that can't be read.
+type ParseError struct {
+	Line, Column int
+	// Truck is the id of the truck, or -1 if its header couldn't be read.
+	Truck int
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	if e.Truck < 0 {
+		return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("line %d, column %d (truck %d): %v", e.Line, e.Column, e.Truck, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
 type truck struct {
 	id      int
 	pallets []pallet
+	// size is the size of the truck's pallets. A truck with no size set
+	// carries pallets of the default size.
+	size palletSize
+}
+
+// dims returns the size of the truck's pallets.
+func (t truck) dims() palletSize {
+	if t.size == (palletSize{}) {
+		return defaultPalletSize
+	}
+	return t.size
+}
+
+var errTruckHeader = errors.New("truck header must look like \"truck <id> [pallet=WxL] [maxweight=N]\"")
+
+// headerFromString reads the id and pallet size of a truck from a line of
+// the form "truck <id> [pallet=WxL] [maxweight=N]".
+func (t *truck) headerFromString(in string) error {
+	f := strings.Fields(in)
+	if len(f) < 2 || len(f) > 4 || f[0] != "truck" {
+		return errTruckHeader
+	}
+	if _, err := fmt.Sscan(f[1], &t.id); err != nil {
+		return err
+	}
+	size := defaultPalletSize
+	for _, a := range f[2:] {
+		switch {
+		case strings.HasPrefix(a, "pallet="):
+			dims, err := palletSizeFromString(strings.TrimPrefix(a, "pallet="))
+			if err != nil {
+				return err
+			}
+			size.w, size.l, size.h = dims.w, dims.l, dims.h
+		case strings.HasPrefix(a, "maxweight="):
+			n, err := strconv.ParseUint(strings.TrimPrefix(a, "maxweight="), 10, 32)
+			if err != nil {
+				return errTruckHeader
+			}
+			size.maxWeight = uint32(n)
+		default:
+			return errTruckHeader
+		}
+	}
+	if len(f) > 2 {
+		t.size = size
+	}
+	return nil
 }
 
 const idLastTruck = 0
 
 func newTruckReader(r io.Reader) *truckReader {
 	return &truckReader{
-		scn: bufio.NewScanner(r),
+		scn:     bufio.NewScanner(r),
+		lenient: lenientParsing,
 	}
 }
 
+// Next returns the next truck. A lenient reader skips the rest of a truck
+// that can't be read, and carries on with the one after it.
 func (r *truckReader) Next() (*truck, error) {
 	if r.err != nil {
 		return nil, r.err
 	}
 
 	t := &truck{}
+	skipping := false
 	for {
 		if r.scn.Scan() == false {
 			r.err = r.scn.Err()
@@ -199,26 +685,108 @@ func (r *truckReader) Next() (*truck, error) {
 			}
 			return nil, r.err
 		}
-
-		if strings.HasPrefix(r.scn.Text(), "truck") {
-			var truck string
-			_, r.err = fmt.Sscanln(r.scn.Text(), &truck, &t.id)
-			if r.err != nil {
-				return nil, r.err
+		r.line++
+		line := r.scn.Text()
+
+		if strings.HasPrefix(line, "truck") {
+			// A truck that was being skipped had no endtruck.
+			t, skipping = &truck{}, false
+			if err := t.headerFromString(line); err != nil {
+				if !r.skip(&ParseError{Line: r.line, Column: 1, Truck: -1, Err: err}) {
+					return nil, r.err
+				}
+				skipping = true
 			}
 			continue
 		}
 
-		if r.scn.Text() == "endtruck" {
+		if line == "endtruck" {
+			if skipping {
+				t, skipping = &truck{}, false
+				continue
+			}
 			break
 		}
+		if skipping {
+			continue
+		}
 
-		var p pallet
-		p, r.err = palletFromString(r.scn.Text())
-		if r.err != nil {
-			return nil, r.err
+		p, col, err := palletFromStringAt(line)
+		if err == io.EOF {
+			err = errShortBox
 		}
+		if err != nil {
+			if !r.skip(&ParseError{Line: r.line, Column: col, Truck: t.id, Err: err}) {
+				return nil, r.err
+			}
+			skipping = true
+			continue
+		}
+		p.size = t.size
 		t.pallets = append(t.pallets, p)
 	}
 	return t, r.err
 }
+
+// skip records a truck that can't be read, and reports whether to carry on.
+// Readers that aren't lenient stop at the first one.
+func (r *truckReader) skip(e *ParseError) bool {
+	if !r.lenient {
+		r.err = e
+		return false
+	}
+	r.skipped = append(r.skipped, e)
+	return true
+}
+
+// Skipped returns the errors for the trucks that a lenient reader skipped.
+func (r *truckReader) Skipped() []*ParseError {
+	return r.skipped
+}
+
+// A truckWriter writes trucks to an io.Writer in the format that truckReader
+// reads, with one pallet per line.
+type truckWriter struct {
+	w   io.Writer
+	err error
+}
+
+func newTruckWriter(w io.Writer) *truckWriter {
+	return &truckWriter{w: w}
+}
+
+// header formats the line that starts a truck.
+func (t truck) header() string {
+	out := fmt.Sprintf("truck %d", t.id)
+	if t.size.w > 0 && t.size.l > 0 {
+		dims := t.size
+		dims.maxWeight = 0
+		out += " pallet=" + dims.String()
+	}
+	if t.size.maxWeight > 0 {
+		out += fmt.Sprintf(" maxweight=%d", t.size.maxWeight)
+	}
+	return out
+}
+
+// Write writes one truck. Once a write fails, every later one returns the
+// same error.
+func (w *truckWriter) Write(t *truck) error {
+	if w.err != nil {
+		return w.err
+	}
+	lines := make([]string, 0, len(t.pallets)+2)
+	lines = append(lines, t.header())
+	for _, p := range t.pallets {
+		lines = append(lines, p.OneLine())
+	}
+	lines = append(lines, "endtruck")
+	_, w.err = io.WriteString(w.w, strings.Join(lines, "\n")+"\n")
+	return w.err
+}
+
+// Close implements truckSink. Trucks are written as they come, so there's
+// nothing left to do.
+func (w *truckWriter) Close() error {
+	return w.err
+}
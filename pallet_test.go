@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"io"
 	"os"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -59,6 +61,54 @@ func TestTruckReader(t *testing.T) {
 	}
 }
 
+func TestTruckReaderPalletSize(t *testing.T) {
+	r := newTruckReader(strings.NewReader(`truck 7 pallet=2x5
+0 0 5 1 101,1 0 1 1 102
+endtruck
+truck 8
+2 3 1 1 103
+endtruck
+`))
+
+	truck, err := r.Next()
+	if err != nil {
+		t.Fatal("truck read:", err)
+	}
+	if truck.id != 7 || truck.dims() != (palletSize{w: 2, l: 5}) {
+		t.Fatalf("truck %v has pallets %v, expected 7 with 2x5", truck.id, truck.dims())
+	}
+	if err := truck.pallets[0].IsValid(); err != nil {
+		t.Error("pallet 0:", err)
+	}
+
+	// No size is the default size.
+	truck, err = r.Next()
+	if err != nil {
+		t.Fatal("truck read:", err)
+	}
+	if truck.id != 8 || truck.dims() != defaultPalletSize {
+		t.Fatalf("truck %v has pallets %v, expected 8 with %v", truck.id, truck.dims(), defaultPalletSize)
+	}
+	if err := truck.pallets[0].IsValid(); err != nil {
+		t.Error("pallet 0:", err)
+	}
+}
+
+func TestBadTruckHeader(t *testing.T) {
+	for _, in := range []string{
+		"truck",
+		"truck 7 4x6",
+		"truck 7 pallet=4",
+		"truck 7 pallet=4x6 extra",
+		"truck seven",
+	} {
+		var tr truck
+		if err := tr.headerFromString(in); err == nil {
+			t.Errorf("%q: missing error", in)
+		}
+	}
+}
+
 func TestNoInputTruckReader(t *testing.T) {
 	r := newTruckReader(strings.NewReader(""))
 	_, err := r.Next()
@@ -85,6 +135,84 @@ func TestErrTruckReader(t *testing.T) {
 	}
 }
 
+const testBadTrucks = `truck 1
+0 0 1 1 101
+endtruck
+truck 2
+0 0 1 1 102,1 1 5 5
+0 0 1 1 103
+endtruck
+truck two
+0 0 1 1 104
+endtruck
+truck 3
+0 0 1 1 105
+0 0 x 1 106
+truck 4
+0 0 1 1 107
+endtruck
+`
+
+func TestParseError(t *testing.T) {
+	r := newTruckReader(strings.NewReader(testBadTrucks))
+	if tr, err := r.Next(); err != nil || tr.id != 1 {
+		t.Fatal("truck 1:", tr, err)
+	}
+	_, err := r.Next()
+	pe, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("error %v is not a ParseError", err)
+	}
+	if pe.Line != 5 || pe.Column != 13 || pe.Truck != 2 || pe.Err != errShortBox {
+		t.Errorf("error %+v", pe)
+	}
+	// A bad file must not look like one that ended.
+	if errors.Is(err, io.EOF) {
+		t.Error("missing box id is io.EOF")
+	}
+	if _, err := r.Next(); err != pe {
+		t.Error("error not kept:", err)
+	}
+}
+
+func TestLenientTruckReader(t *testing.T) {
+	r := newTruckReader(strings.NewReader(testBadTrucks))
+	r.lenient = true
+	var ids []int
+	for {
+		tr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, tr.id)
+	}
+	if want := []int{1, 4}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("read trucks %v, want %v", ids, want)
+	}
+
+	want := []ParseError{
+		{Line: 5, Column: 13, Truck: 2, Err: errShortBox},
+		{Line: 8, Column: 1, Truck: -1},
+		{Line: 13, Column: 1, Truck: 3},
+	}
+	skipped := r.Skipped()
+	if len(skipped) != len(want) {
+		t.Fatalf("skipped %v", skipped)
+	}
+	for i, w := range want {
+		got := *skipped[i]
+		if got.Line != w.Line || got.Column != w.Column || got.Truck != w.Truck || w.Err != nil && got.Err != w.Err {
+			t.Errorf("skipped %d: %v, want line %d, column %d, truck %d", i, skipped[i], w.Line, w.Column, w.Truck)
+		}
+	}
+	if !strings.Contains(skipped[0].Error(), "line 5, column 13 (truck 2)") {
+		t.Errorf("error says %q", skipped[0])
+	}
+}
+
 func TestBadPallet(t *testing.T) {
 	// gridbox missing id
 	_, err := palletFromString("1 1 5 5")
@@ -105,6 +233,303 @@ func TestBadPallet(t *testing.T) {
 	}
 }
 
+func TestPalletSizeFromString(t *testing.T) {
+	cases := []struct {
+		in   string
+		want palletSize
+		err  error
+	}{
+		{"4x4", palletSize{w: 4, l: 4}, nil},
+		{"4x6", palletSize{w: 4, l: 6}, nil},
+		{"10x3", palletSize{w: 10, l: 3}, nil},
+		{"4x4x2", palletSize{w: 4, l: 4, h: 2}, nil},
+		{"4x4x0", palletSize{}, errPalletSize},
+		{"4x4x2x2", palletSize{}, errPalletSize},
+		{"0x4", palletSize{}, errPalletSize},
+		{"4", palletSize{}, errPalletSize},
+		{"4by4", palletSize{}, errPalletSize},
+		{"", palletSize{}, errPalletSize},
+	}
+	for _, c := range cases {
+		got, err := palletSizeFromString(c.in)
+		if got != c.want || err != c.err {
+			t.Errorf("%q: got %v, %v; want %v, %v", c.in, got, err, c.want, c.err)
+		}
+	}
+}
+
+func TestNonSquarePallet(t *testing.T) {
+	size := palletSize{w: 2, l: 5}
+
+	// A box along the whole length, and one across the whole width.
+	p := newPallet(size)
+	p.boxes = append(p.boxes, box{x: 0, y: 0, w: 5, l: 1, id: 101}, box{x: 1, y: 0, w: 1, l: 1, id: 102}, box{x: 1, y: 4, w: 1, l: 1, id: 103})
+	if err := p.IsValid(); err != nil {
+		t.Error(err)
+	}
+	want := "\n| ! ! ! ! ! |\n| @       # |\n"
+	if got := p.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Fits on a 4x4 pallet, but goes off the edge of this one.
+	p.boxes = []box{{x: 2, y: 0, w: 1, l: 1, id: 101}}
+	if err := p.IsValid(); err != errEdge(0) {
+		t.Error("wrong err:", err)
+	}
+	p.boxes = []box{{x: 0, y: 3, w: 3, l: 1, id: 101}}
+	if err := p.IsValid(); err != errEdge(0) {
+		t.Error("wrong err:", err)
+	}
+
+	// A pallet with no size is the default size.
+	p = &pallet{boxes: []box{{x: 3, y: 3, w: 1, l: 1, id: 101}}}
+	if err := p.IsValid(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLastSize(t *testing.T) {
+	var ls lastSize
+	if got := ls.size(); got != (palletSize{}) {
+		t.Errorf("got %v with no trucks, want the zero size", got)
+	}
+
+	// Of two sizes with the same area, the first wins, and a size that no
+	// truck brought is never made up.
+	ls.add(&truck{id: 1, size: palletSize{w: 4, l: 6}, pallets: []pallet{{boxes: []box{{w: 6, l: 4, id: 101}}}}})
+	ls.add(&truck{id: 2, size: palletSize{w: 6, l: 4}, pallets: []pallet{{boxes: []box{{w: 4, l: 6, id: 102}}}}})
+	ls.add(&truck{id: 3, size: palletSize{w: 2, l: 2}})
+	if got, want := ls.size(), (palletSize{w: 4, l: 6}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A locked box only fits the other way around.
+	ls.add(&truck{id: 4, size: palletSize{w: 6, l: 4}, pallets: []pallet{{boxes: []box{{w: 1, l: 6, id: 103, locked: true}}}}})
+	if got, want := ls.size(), (palletSize{w: 6, l: 4}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// When no size holds everything, the biggest is used.
+	ls.add(&truck{id: 5, size: palletSize{w: 3, l: 9}, pallets: []pallet{{boxes: []box{{w: 9, l: 1, id: 104, locked: true}}}}})
+	if got, want := ls.size(), (palletSize{w: 3, l: 9}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestStackedPallet(t *testing.T) {
+	p := newPallet(palletSize{w: 2, l: 2, h: 3})
+	p.boxes = []box{
+		{x: 0, y: 0, w: 2, l: 1, h: 2, id: 101},
+		{x: 1, y: 0, w: 2, l: 1, id: 102},
+		{x: 0, y: 0, z: 2, w: 1, l: 1, id: 103},
+		{x: 1, y: 0, z: 1, w: 2, l: 1, id: 104},
+	}
+	if err := p.IsValid(); err != nil {
+		t.Error(err)
+	}
+	want := "\n| ! ! |\n| @ @ |\n\n| ! ! |\n| $ $ |\n\n| #   |\n|     |\n"
+	if got := p.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Nothing under part of it.
+	p.boxes = append(p.boxes, box{x: 0, y: 0, z: 3, w: 2, l: 1, id: 105})
+	p.size.h = 4
+	if err := p.IsValid(); err != errFloating(4) {
+		t.Error("wrong err:", err)
+	}
+
+	// Through the top.
+	p.size.h = 3
+	p.boxes = p.boxes[:4]
+	p.boxes[2].h = 2
+	if err := p.IsValid(); err != errEdge(2) {
+		t.Error("wrong err:", err)
+	}
+
+	// Into another box.
+	p.boxes[2].h = 1
+	p.boxes[3].z = 0
+	if _, ok := p.IsValid().(errOverlap); !ok {
+		t.Error("wrong err:", p.IsValid())
+	}
+}
+
+func TestBoxAttrs(t *testing.T) {
+	b, err := boxFromString("1 0 2 1 101 z=1 h=3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (box{x: 1, y: 0, z: 1, w: 2, l: 1, h: 3, id: 101}); b != want {
+		t.Errorf("got %v, want %v", b, want)
+	}
+	if s := b.String(); s != "1 0 2 1 101 z=1 h=3" {
+		t.Error("wrong format:", s)
+	}
+	if s := (box{w: 1, l: 1, h: 1, id: 102}).String(); s != "0 0 1 1 102" {
+		t.Error("wrong format:", s)
+	}
+	if (box{w: 1, l: 1, h: 1}).canon() != (box{w: 1, l: 1}).canon() {
+		t.Error("one layer tall boxes differ")
+	}
+
+	for _, in := range []string{"0 0 1 1 101 h=0", "0 0 1 1 101 q=1", "0 0 1 1 101 z=x"} {
+		if _, err := boxFromString(in); err == nil {
+			t.Errorf("%q: missing error", in)
+		}
+	}
+}
+
+func TestPalletWeight(t *testing.T) {
+	p := newPallet(palletSize{w: 4, l: 4, maxWeight: 10})
+	p.boxes = []box{
+		{x: 0, y: 0, w: 1, l: 1, id: 101, weight: 4},
+		{x: 1, y: 0, w: 1, l: 1, id: 102, weight: 6},
+		{x: 2, y: 0, w: 1, l: 1, id: 103},
+	}
+	if err := p.IsValid(); err != nil {
+		t.Error(err)
+	}
+	p.boxes = append(p.boxes, box{x: 3, y: 0, w: 1, l: 1, id: 104, weight: 1})
+	if err := p.IsValid(); err != errOverweight(3) {
+		t.Error("wrong err:", err)
+	}
+
+	// No limit.
+	p.size.maxWeight = 0
+	if err := p.IsValid(); err != nil {
+		t.Error(err)
+	}
+
+	b, err := boxFromString("1 2 3 1 101 25 h=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (box{x: 1, y: 2, w: 3, l: 1, h: 2, id: 101, weight: 25}); b != want {
+		t.Errorf("got %v, want %v", b, want)
+	}
+	if s := b.String(); s != "1 2 3 1 101 25 h=2" {
+		t.Error("wrong format:", s)
+	}
+
+	var tr truck
+	if err := tr.headerFromString("truck 3 maxweight=500 pallet=4x6"); err != nil {
+		t.Fatal(err)
+	}
+	if want := (palletSize{w: 4, l: 6, maxWeight: 500}); tr.dims() != want {
+		t.Errorf("got %+v, want %+v", tr.dims(), want)
+	}
+}
+
+func TestLockedBox(t *testing.T) {
+	b, err := boxFromString("0 0 1 3 101 lock=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (box{w: 1, l: 3, id: 101, locked: true}); b != want {
+		t.Errorf("got %v, want %v", b, want)
+	}
+	if s := b.String(); s != "0 0 1 3 101 lock=1" {
+		t.Error("wrong format:", s)
+	}
+
+	// Locked boxes keep their orientation.
+	r := b
+	upright(&r)
+	sideways(&r)
+	if r != b {
+		t.Errorf("locked box turned into %v", r)
+	}
+	if r.w, r.l = r.l, r.w; r.canon() == b.canon() {
+		t.Error("rotated locked box has the same canon form")
+	}
+	if !(palletSize{w: 3, l: 1}).holds(b) || (palletSize{w: 1, l: 3}).holds(b) {
+		t.Error("locked box held the wrong way around")
+	}
+
+	if _, err := boxFromString("0 0 1 3 101 lock=2"); err == nil {
+		t.Error("missing error")
+	}
+}
+
+func TestFragileBox(t *testing.T) {
+	b, err := boxFromString("0 0 2 2 101 fragile=1 hazard=3 temp=2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (box{w: 2, l: 2, id: 101, fragile: true, hazard: 3, temp: 2}); b != want {
+		t.Errorf("got %v, want %v", b, want)
+	}
+	if s := b.String(); s != "0 0 2 2 101 fragile=1 hazard=3 temp=2" {
+		t.Error("wrong format:", s)
+	}
+
+	// Nothing goes on top.
+	p := newPallet(palletSize{w: 2, l: 2, h: 2})
+	p.boxes = []box{b, {z: 1, w: 1, l: 1, id: 102}}
+	if err := p.IsValid(); err != errCrushed(1) {
+		t.Error("wrong err:", err)
+	}
+	p.boxes = []box{b}
+	unused := stackLayers(p, []box{{w: 1, l: 1, id: 102}})
+	if len(unused) != 1 {
+		t.Errorf("stacked on a fragile box%s", p)
+	}
+}
+
+func TestTruckWriter(t *testing.T) {
+	in := testTruck + `truck 2 pallet=4x6x2 maxweight=50
+0 0 2 3 106 12 lock=1 fragile=1,2 0 1 1 107 z=1 h=2 hazard=3 temp=1
+endtruck
+truck 3 maxweight=20
+1 1 1 1 108
+endtruck
+truck 0
+endtruck
+`
+	r := newTruckReader(strings.NewReader(in))
+	var out strings.Builder
+	w := newTruckWriter(&out)
+	for {
+		tr, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Write(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Sizes that were left to the default are written out in full.
+	want := strings.Replace(in, "truck 3 maxweight=20", "truck 3 pallet=4x4 maxweight=20", 1)
+	if out.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+type errWriter struct{}
+
+func (ew errWriter) Write(buf []byte) (int, error) {
+	return 0, io.ErrShortWrite
+}
+
+func TestErrTruckWriter(t *testing.T) {
+	w := newTruckWriter(errWriter{})
+	if err := w.Write(&truck{id: 1}); err != io.ErrShortWrite {
+		t.Error("wrong err:", err)
+	}
+	if err := w.Close(); err != io.ErrShortWrite {
+		t.Error("wrong 2nd err:", err)
+	}
+}
+
 func BenchmarkRead(b *testing.B) {
 	f, err := os.Open("testdata/100trucks.txt")
 	if err != nil {
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A cancelPacker is a Packer that can give up early. Once done is closed,
+// PackUntil returns soon, with a pallet that is packed correctly but maybe
+// not as well.
+type cancelPacker interface {
+	Packer
+	PackUntil(done <-chan struct{}, pal *pallet, boxes []box) []box
+}
+
+// portfolio is a Packer that races several packers on the same boxes, each
+// in its own goroutine, and keeps the best pallet: the one that covers the
+// most cells, using the fewest boxes so that small boxes are left for later.
+// As soon as one of them fills the pallet, the others are cancelled.
+type portfolio struct {
+	names   []string
+	packers []Packer
+}
+
+// newPortfolio returns a portfolio of the registered packers named.
+func newPortfolio(names ...string) (*portfolio, error) {
+	p := &portfolio{names: names}
+	for _, name := range names {
+		pk, err := lookupPacker(name)
+		if err != nil {
+			return nil, err
+		}
+		p.packers = append(p.packers, pk)
+	}
+	return p, nil
+}
+
+// portfolioResult is the pallet one packer came up with.
+type portfolioResult struct {
+	n      int
+	pal    *pallet
+	unused []box
+	cells  int
+}
+
+// better returns true if r beats o.
+func (r portfolioResult) better(o portfolioResult) bool {
+	if r.cells != o.cells {
+		return r.cells > o.cells
+	}
+	return len(r.pal.boxes) < len(o.pal.boxes)
+}
+
+// Pack implements Packer.
+func (p *portfolio) Pack(pal *pallet, boxes []box) []box {
+	return p.PackUntil(nil, pal, boxes)
+}
+
+// PackUntil implements cancelPacker. Once stop is closed, the packers that
+// can give up early are cancelled too.
+func (p *portfolio) PackUntil(stop <-chan struct{}, pal *pallet, boxes []box) []box {
+	done := make(chan struct{})
+	var once sync.Once
+	cancel := func() { once.Do(func() { close(done) }) }
+	defer cancel()
+	if stop != nil {
+		finished := make(chan struct{})
+		defer close(finished)
+		go func() {
+			select {
+			case <-stop:
+				cancel()
+			case <-finished:
+			}
+		}()
+	}
+
+	// The goroutines may outlive this call, so they never touch pal.
+	size := pal.dims()
+	results := make(chan portfolioResult, len(p.packers))
+	for n, pk := range p.packers {
+		// Packers may sort the boxes they're given, so each gets a copy.
+		in := make([]box, len(boxes))
+		copy(in, boxes)
+		go func(n int, pk Packer) {
+			r := portfolioResult{n: n, pal: newPallet(size)}
+			if c, ok := pk.(cancelPacker); ok {
+				r.unused = c.PackUntil(done, r.pal, in)
+			} else {
+				r.unused = pk.Pack(r.pal, in)
+			}
+			for _, b := range r.pal.boxes {
+				r.cells += int(b.w) * int(b.l)
+			}
+			results <- r
+		}(n, pk)
+	}
+
+	best := portfolioResult{n: -1}
+	for range p.packers {
+		r := <-results
+		if best.n < 0 || r.better(best) {
+			best = r
+		}
+		if best.cells == size.cells() {
+			break
+		}
+	}
+	if debug {
+		fmt.Printf("  portfolio: %s wins with %d cells\n", p.names[best.n], best.cells)
+	}
+	pal.boxes = append(pal.boxes, best.pal.boxes...)
+	return best.unused
+}
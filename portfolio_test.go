@@ -0,0 +1,64 @@
+package main
+
+import "testing"
+
+func TestPortfolio(t *testing.T) {
+	p, err := newPortfolio("shelves", "exact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only exact finds the full pallet.
+	boxes := []box{
+		{x: 0, y: 0, w: 3, l: 1, id: 90},
+		{x: 0, y: 0, w: 1, l: 3, id: 91},
+		{x: 0, y: 0, w: 3, l: 3, id: 92},
+		{x: 0, y: 0, w: 1, l: 1, id: 93},
+		{x: 0, y: 0, w: 2, l: 2, id: 94},
+	}
+	pal := &pallet{}
+	unused := p.Pack(pal, boxes)
+	if err := pal.IsValid(); err != nil {
+		t.Fatalf("pallet is not packed correctly: %s", err)
+	}
+	if len(pal.boxes) != 4 || len(unused) != 1 || unused[0].id != 94 {
+		t.Errorf("got %d boxes and unused %v, want 4 and box 94%s", len(pal.boxes), unused, pal)
+	}
+
+	if _, err := newPortfolio("shelves", "nope"); err == nil {
+		t.Error("missing error for unknown packer")
+	}
+}
+
+func TestExactPackUntil(t *testing.T) {
+	done := make(chan struct{})
+	close(done)
+	boxes := make([]box, 0, 40)
+	for i := 0; i < 40; i++ {
+		boxes = append(boxes, box{w: uint8(i%3 + 1), l: uint8(i%2 + 1), id: uint32(100 + i)})
+	}
+	pal := &pallet{}
+	unused := exactPacker(exactMostCells).PackUntil(done, pal, boxes)
+	if err := pal.IsValid(); err != nil {
+		t.Errorf("cancelled pallet is not valid: %s", err)
+	}
+	if got, want := len(pal.boxes)+len(unused), len(boxes); got != want {
+		t.Errorf("got %d boxes back, want %d", got, want)
+	}
+	if len(pal.boxes) == 0 {
+		t.Error("cancelled pallet is empty, want it packed with MaxRects")
+	}
+
+	// A portfolio passes the cancel on to the exact packer.
+	p, err := newPortfolio("maxrects", "exact")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pal = &pallet{}
+	unused = p.PackUntil(done, pal, boxes)
+	if err := pal.IsValid(); err != nil {
+		t.Errorf("cancelled portfolio pallet is not valid: %s", err)
+	}
+	if got, want := len(pal.boxes)+len(unused), len(boxes); got != want {
+		t.Errorf("portfolio gave %d boxes back, want %d", got, want)
+	}
+}
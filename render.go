@@ -0,0 +1,341 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Sizes in a rendered picture, in pixels.
+const (
+	renderCell    = 32
+	renderMargin  = 10
+	renderCaption = 18
+)
+
+var (
+	renderBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	renderDeck       = color.RGBA{0xe8, 0xe4, 0xdc, 0xff}
+	renderLine       = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	renderError      = color.RGBA{0xe0, 0x10, 0x10, 0xa0}
+)
+
+// A drawing is a picture made of rectangles and text, which can be written
+// as SVG or PNG.
+type drawing struct {
+	w, h  int
+	rects []drawRect
+	texts []drawText
+}
+
+type drawRect struct {
+	x, y, w, h int
+	fill       color.RGBA
+	outline    bool
+}
+
+// drawText is a line of text with its baseline at x, y. Captions are only
+// written to SVG; PNG only has a font for box ids.
+type drawText struct {
+	x, y    int
+	s       string
+	caption bool
+}
+
+// A renderPanel is one pallet in a picture, with a caption above it.
+type renderPanel struct {
+	caption string
+	pal     pallet
+}
+
+// truckPanels returns a panel for each of the truck's pallets. Pallets that
+// are not correctly packed say why in their caption.
+func truckPanels(t *truck) []renderPanel {
+	panels := make([]renderPanel, len(t.pallets))
+	for i, p := range t.pallets {
+		if p.size == (palletSize{}) {
+			p.size = t.size
+		}
+		caption := fmt.Sprintf("truck %d pallet %d (%v)", t.id, i, p.dims())
+		if err := p.IsValid(); err != nil {
+			caption += ": " + err.Error()
+		}
+		panels[i] = renderPanel{caption: caption, pal: p}
+	}
+	return panels
+}
+
+// boxColor picks a color for a box from its id, so that a box keeps its
+// color from one picture to the next.
+func boxColor(id uint32) color.RGBA {
+	h := float64((id*2654435761)>>16%360) / 60
+	s, v := 0.45, 0.95
+	c := v * s
+	x := c * (1 - abs(mod2(h)-1))
+	var r, g, b float64
+	switch int(h) {
+	case 0:
+		r, g = c, x
+	case 1:
+		r, g = x, c
+	case 2:
+		g, b = c, x
+	case 3:
+		g, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := v - c
+	return color.RGBA{uint8((r + m) * 255), uint8((g + m) * 255), uint8((b + m) * 255), 0xff}
+}
+
+func abs(f float64) float64 {
+	if f < 0 {
+		return -f
+	}
+	return f
+}
+
+// mod2 returns f modulo 2.
+func mod2(f float64) float64 {
+	return f - 2*float64(int(f/2))
+}
+
+// drawPanels lays the panels out from top to bottom. The layers of a
+// pallet go left to right. Cells covered by more than one box, and the
+// parts of boxes that go off the edge, are covered in red.
+func drawPanels(panels []renderPanel) *drawing {
+	d := &drawing{w: 2 * renderMargin, h: renderMargin}
+	for _, pn := range panels {
+		size := pn.pal.dims()
+
+		// The pallet, and anything hanging off it.
+		rows, cols := int(size.w), int(size.l)
+		for _, b := range pn.pal.boxes {
+			if n := int(b.x) + int(b.l); n > rows {
+				rows = n
+			}
+			if n := int(b.y) + int(b.w); n > cols {
+				cols = n
+			}
+		}
+
+		d.texts = append(d.texts, drawText{x: renderMargin, y: d.h + renderCaption - 5, s: pn.caption, caption: true})
+		top := d.h + renderCaption
+		for k := 0; k < size.height(); k++ {
+			left := renderMargin + k*(cols*renderCell+renderMargin)
+			d.rects = append(d.rects, drawRect{
+				x: left, y: top,
+				w: int(size.l) * renderCell, h: int(size.w) * renderCell,
+				fill: renderDeck, outline: true,
+			})
+
+			count := make([]int, rows*cols)
+			for _, b := range pn.pal.boxes {
+				if k < int(b.z) || k >= int(b.z)+b.height() {
+					continue
+				}
+				d.rects = append(d.rects, drawRect{
+					x: left + int(b.y)*renderCell, y: top + int(b.x)*renderCell,
+					w: int(b.w) * renderCell, h: int(b.l) * renderCell,
+					fill: boxColor(b.id), outline: true,
+				})
+				d.texts = append(d.texts, drawText{
+					x: left + int(b.y)*renderCell + 4, y: top + int(b.x)*renderCell + 14,
+					s: fmt.Sprint(b.id),
+				})
+				for i := int(b.x); i < int(b.x)+int(b.l); i++ {
+					for j := int(b.y); j < int(b.y)+int(b.w); j++ {
+						count[i*cols+j]++
+					}
+				}
+			}
+			for i := 0; i < rows; i++ {
+				for j := 0; j < cols; j++ {
+					n := count[i*cols+j]
+					if n > 1 || (n > 0 && (i >= int(size.w) || j >= int(size.l))) {
+						d.rects = append(d.rects, drawRect{
+							x: left + j*renderCell, y: top + i*renderCell,
+							w: renderCell, h: renderCell,
+							fill: renderError,
+						})
+					}
+				}
+			}
+			if right := left + cols*renderCell + renderMargin; right > d.w {
+				d.w = right
+			}
+		}
+		d.h = top + rows*renderCell + renderMargin
+	}
+	if d.w < 300 {
+		d.w = 300
+	}
+	return d
+}
+
+// hex formats a color for SVG.
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// writeSVG writes the drawing as SVG.
+func (d *drawing) writeSVG(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`+"\n", d.w, d.h, d.w, d.h)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="%s"/>`+"\n", d.w, d.h, hex(renderBackground))
+	for _, r := range d.rects {
+		fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="%s"`, r.x, r.y, r.w, r.h, hex(r.fill))
+		if r.fill.A != 0xff {
+			fmt.Fprintf(&b, ` fill-opacity="%.2f"`, float64(r.fill.A)/0xff)
+		}
+		if r.outline {
+			fmt.Fprintf(&b, ` stroke="%s"`, hex(renderLine))
+		}
+		b.WriteString("/>\n")
+	}
+	for _, t := range d.texts {
+		size := 11
+		if t.caption {
+			size = 13
+		}
+		fmt.Fprintf(&b, `<text x="%d" y="%d" font-family="sans-serif" font-size="%d">%s</text>`+"\n", t.x, t.y, size, html.EscapeString(t.s))
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// digitFont is a 3x5 pixel font for box ids. Each digit is five rows of
+// three bits.
+var digitFont = [10][5]uint8{
+	{7, 5, 5, 5, 7}, {2, 6, 2, 2, 7}, {7, 1, 7, 4, 7}, {7, 1, 7, 1, 7}, {5, 5, 7, 1, 1},
+	{7, 4, 7, 1, 7}, {7, 4, 7, 5, 7}, {7, 1, 1, 1, 1}, {7, 5, 7, 5, 7}, {7, 5, 7, 1, 7},
+}
+
+// writePNG writes the drawing as a PNG image.
+func (d *drawing) writePNG(w io.Writer) error {
+	img := image.NewRGBA(image.Rect(0, 0, d.w, d.h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{renderBackground}, image.Point{}, draw.Src)
+	for _, r := range d.rects {
+		box := image.Rect(r.x, r.y, r.x+r.w, r.y+r.h)
+		draw.Draw(img, box, &image.Uniform{r.fill}, image.Point{}, draw.Over)
+		if r.outline {
+			line := &image.Uniform{renderLine}
+			for _, edge := range []image.Rectangle{
+				image.Rect(box.Min.X, box.Min.Y, box.Max.X, box.Min.Y+1),
+				image.Rect(box.Min.X, box.Max.Y-1, box.Max.X, box.Max.Y),
+				image.Rect(box.Min.X, box.Min.Y, box.Min.X+1, box.Max.Y),
+				image.Rect(box.Max.X-1, box.Min.Y, box.Max.X, box.Max.Y),
+			} {
+				draw.Draw(img, edge, line, image.Point{}, draw.Src)
+			}
+		}
+	}
+	for _, t := range d.texts {
+		if t.caption {
+			continue
+		}
+		// Two pixels per font pixel, with the bottom on the baseline.
+		x, y := t.x, t.y-10
+		for _, c := range t.s {
+			if c < '0' || c > '9' {
+				continue
+			}
+			for row, bits := range digitFont[c-'0'] {
+				for col := 0; col < 3; col++ {
+					if bits&(4>>uint(col)) != 0 {
+						dot := image.Rect(x+2*col, y+2*row, x+2*col+2, y+2*row+2)
+						draw.Draw(img, dot, &image.Uniform{renderLine}, image.Point{}, draw.Src)
+					}
+				}
+			}
+			x += 8
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// renderMain runs the render subcommand, which draws the trucks in a
+// manifest file as SVG or PNG.
+func renderMain(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	truckID := fs.Int("truck", -1, "Only draw the truck with this id.")
+	palletN := fs.Int("n", -1, "Only draw this pallet of each truck, counting from 0.")
+	out := fs.String("o", "", "The file to write. Files ending in .png are PNG, anything else SVG. Defaults to standard output.")
+	asPNG := fs.Bool("png", false, "Write PNG, even if the file doesn't end in .png.")
+	format := fs.String("format", formatAuto, "The format of the manifest: "+strings.Join(formats, ", ")+".")
+	palletDims := fs.String("pallet", defaultPalletSize.String(), "The size of pallets that the manifest doesn't give a size for.")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s render [flags] manifest\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	size, err := palletSizeFromString(*palletDims)
+	if err != nil {
+		return err
+	}
+	defaultPalletSize = size
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	src, err := newTruckSource(f, *format)
+	if err != nil {
+		return err
+	}
+
+	var panels []renderPanel
+	for {
+		t, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if *truckID >= 0 && t.id != *truckID {
+			continue
+		}
+		for i, pn := range truckPanels(t) {
+			if *palletN < 0 || i == *palletN {
+				panels = append(panels, pn)
+			}
+		}
+	}
+	if len(panels) == 0 {
+		return fmt.Errorf("nothing to draw in %s", fs.Arg(0))
+	}
+	d := drawPanels(panels)
+
+	w := io.Writer(os.Stdout)
+	if *out != "" {
+		of, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer of.Close()
+		w = of
+	}
+	if *asPNG || strings.EqualFold(filepath.Ext(*out), ".png") {
+		return d.writePNG(w)
+	}
+	return d.writeSVG(w)
+}
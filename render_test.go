@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func Test_drawPanels_errors(t *testing.T) {
+	tr := &truck{id: 3, pallets: []pallet{
+		{boxes: []box{
+			{x: 0, y: 0, w: 2, l: 2, id: 101},
+			{x: 1, y: 1, w: 2, l: 1, id: 102},
+		}},
+		{boxes: []box{{x: 3, y: 3, w: 2, l: 1, id: 103}}},
+		{boxes: []box{{x: 0, y: 0, w: 4, l: 4, id: 104}}},
+	}}
+	panels := truckPanels(tr)
+	if len(panels) != 3 {
+		t.Fatalf("%d panels", len(panels))
+	}
+	if !strings.Contains(panels[0].caption, "overlap") {
+		t.Errorf("caption %q doesn't say the boxes overlap", panels[0].caption)
+	}
+	if !strings.Contains(panels[1].caption, "edge") {
+		t.Errorf("caption %q doesn't say the box is off the edge", panels[1].caption)
+	}
+	if strings.Contains(panels[2].caption, ":") {
+		t.Errorf("caption %q has an error", panels[2].caption)
+	}
+
+	for i, want := range []int{1, 1, 0} {
+		d := drawPanels(panels[i : i+1])
+		red := 0
+		for _, r := range d.rects {
+			if r.fill == renderError {
+				red++
+			}
+		}
+		if red != want {
+			t.Errorf("pallet %d: %d red cells, want %d", i, red, want)
+		}
+	}
+}
+
+func Test_drawing_write(t *testing.T) {
+	tr := &truck{id: 1, pallets: []pallet{{
+		size: palletSize{w: 4, l: 4, h: 2},
+		boxes: []box{
+			{x: 0, y: 0, w: 4, l: 4, id: 7},
+			{x: 0, y: 0, z: 1, w: 1, l: 1, id: 8},
+		},
+	}}}
+	d := drawPanels(truckPanels(tr))
+
+	var svg bytes.Buffer
+	if err := d.writeSVG(&svg); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"<svg", ">7</text>", ">8</text>", "</svg>"} {
+		if !strings.Contains(svg.String(), want) {
+			t.Errorf("SVG has no %q", want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := d.writePNG(&buf); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != d.w || b.Dy() != d.h {
+		t.Errorf("PNG is %v, want %dx%d", b, d.w, d.h)
+	}
+}
+
+func Test_boxColor(t *testing.T) {
+	if boxColor(101) != boxColor(101) {
+		t.Error("colors differ for the same id")
+	}
+	if boxColor(101) == boxColor(102) {
+		t.Error("neighbouring ids have the same color")
+	}
+}
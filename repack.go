@@ -1,446 +1,633 @@
-package main
-
-import (
-	"fmt"
-	"log"
-	"sort"
-	"sync"
-)
-
-const (
-	debug = true
-)
-
-// A repacker repacks trucks.
-type repacker struct {
-}
-
-// counter keeps track of stuff going in and out of the warehouse.
-type counter struct {
-	Name    string
-	In, Out int
-}
-
-// newCounter initializes a counter with a name.
-func newCounter(name string) *counter {
-	return &counter{Name: name}
-}
-
-// Inc adds one to the "in" count.
-func (c *counter) Inc(a int) {
-	c.In += a
-}
-
-// Dec adds one to the "out" count.
-func (c *counter) Dec(a int) {
-	c.Out += a
-}
-
-// Missing is the difference between in and out.
-func (c *counter) Missing() int {
-	return c.In - c.Out
-}
-
-// String is a nice string describing the counter state.
-func (c *counter) String() string {
-	return fmt.Sprintf("%s: %d in, %d out (missing %d)", c.Name, c.In, c.Out, c.Missing())
-}
-
-// warehouse manages the ins and outs of unpacking and packing.
-type warehouse struct {
-	trucks        chan truck
-	boxes         []box
-	hasBox        map[uint32]bool
-	boxesMu       sync.Mutex
-	palletCounter *counter
-	truckCounter  *counter
-	boxCounter    *counter
-}
-
-func (w *warehouse) addBox(b box) {
-	w.boxesMu.Lock()
-	w.hasBox[b.id] = true
-	w.boxes = append(w.boxes, b)
-	w.boxCounter.Inc(1)
-	w.boxesMu.Unlock()
-}
-
-func (w *warehouse) grabSomeBoxes(max int) []box {
-	w.boxesMu.Lock()
-	if l := len(w.boxes); max > l {
-		max = l
-	}
-	out := make([]box, 0, max)
-	for _, b := range w.boxes {
-		if w.hasBox[b.id] {
-			delete(w.hasBox, b.id)
-			out = append(out, b)
-			w.boxCounter.Dec(1)
-			if len(out) > max {
-				break
-			}
-		}
-	}
-	w.boxesMu.Unlock()
-	return out
-}
-
-func (w *warehouse) grabAllBoxes() []box {
-	w.boxesMu.Lock()
-	out := make([]box, 0, len(w.boxes))
-	for _, b := range w.boxes {
-		if w.hasBox[b.id] {
-			delete(w.hasBox, b.id)
-			out = append(out, b)
-			w.boxCounter.Dec(1)
-		}
-	}
-	w.boxesMu.Unlock()
-	return out
-}
-
-func (w *warehouse) returnBoxes(boxes []box) {
-	w.boxesMu.Lock()
-	for _, b := range boxes {
-		w.hasBox[b.id] = true
-		w.boxCounter.Inc(1)
-	}
-	w.boxesMu.Unlock()
-}
-
-// Unpack unloads all boxes from the trucks, and parks all of the trucks to be
-// re-packed.
-func (w *warehouse) Unpack(in <-chan *truck) {
-	// Close trucks after consuming everything.
-	defer close(w.trucks)
-	for t := range in {
-		emptyTruck := &truck{
-			id:      t.id,
-			pallets: make([]pallet, 0, len(t.pallets)),
-		}
-		w.trucks <- *emptyTruck
-		w.truckCounter.Inc(1)
-		for _, p := range t.pallets {
-			w.palletCounter.Inc(1)
-			for _, b := range p.boxes {
-				w.addBox(b)
-			}
-		}
-	}
-}
-
-// PackTruck re-packs a truck as efficiently as possible.
-func (w *warehouse) PackTruck(t *truck) {
-	w.truckCounter.Dec(1)
-	// Pack up to the truck's pallet capacity.
-	for len(t.pallets) < cap(t.pallets) {
-		if debug {
-			fmt.Printf("Packing truck %d pallet %d\n", t.id, len(t.pallets))
-		}
-		p := w.packOnePallet()
-		// If the pallet comes back empty we're done.
-		if len(p.boxes) == 0 {
-			return
-		}
-		w.palletCounter.Dec(1)
-		w.boxCounter.Dec(len(p.boxes))
-		t.pallets = append(t.pallets, *p)
-	}
-}
-
-// PackRemainingBoxes puts all remaining boxes onto this last truck, with no
-// regard for how many pallets should fit.
-func (w *warehouse) PackRemainingBoxes(t *truck) {
-	w.truckCounter.Dec(1)
-	pallets := w.packAllBoxes()
-	for _, p := range pallets {
-		w.palletCounter.Dec(1)
-		w.boxCounter.Dec(len(p.boxes))
-		t.pallets = append(t.pallets, *p)
-	}
-}
-
-const (
-	maxBoxes = 10000
-)
-
-// packOnePallet pulls boxes from the channel, packs as many as it can onto one
-// pallet, then returns any unpacked boxes back to the channel. It returns the
-// packed pallet.
-func (w *warehouse) packOnePallet() *pallet {
-	if debug {
-		fmt.Printf("Packing...\n")
-	}
-
-	// Pack a pallet.
-	pal := &pallet{boxes: make([]box, 0, 16)}
-	boxes := w.grabSomeBoxes(maxBoxes)
-	unusedBoxes := packWithShelves(pal, boxes)
-	w.returnBoxes(unusedBoxes)
-
-	if debug {
-		fmt.Printf("Packed %d of %d boxes on pallet\n", len(pal.boxes), len(boxes))
-		for _, b := range pal.boxes {
-			fmt.Printf("  box %d: x%d, y%d, l%d, w%d\n", b.id, b.x, b.y, b.l, b.w)
-		}
-		fmt.Printf("%s\n", pal)
-	}
-
-	return pal
-}
-
-// packAllBoxes pulls all boxes from the channel and packs them onto pallets
-// until they are all packed. It returns all of the packed pallets.
-func (w *warehouse) packAllBoxes() []*pallet {
-	// Pack until all of the boxes are used.
-	boxes := w.grabAllBoxes()
-	pallets := make([]*pallet, 0, len(boxes))
-	for len(boxes) > 0 {
-		pal := &pallet{boxes: make([]box, 0, 16)}
-		boxes = packWithShelves(pal, boxes)
-		pallets = append(pallets, pal)
-	}
-	return pallets
-}
-
-type sortedBoxes []box
-
-func (boxes sortedBoxes) Len() int {
-	return len(boxes)
-}
-func (boxes sortedBoxes) Less(i, j int) bool {
-	a, b := boxes[i], boxes[j]
-	if a.w == b.w {
-		return a.l < b.l
-	}
-	return a.w > b.w
-}
-func (boxes sortedBoxes) Swap(i, j int) {
-	boxes[i], boxes[j] = boxes[j], boxes[i]
-}
-
-// sideways orients the box sideways.
-func sideways(b *box) {
-	if b.w > b.l {
-		b.w, b.l = b.l, b.w
-	}
-}
-
-// upright orients the box upright.
-func upright(b *box) {
-	if b.w < b.l {
-		b.w, b.l = b.l, b.w
-	}
-}
-
-// shelf models a horizontal plane of boxes. The height of the shelf is
-// determined by the first box. Once a height is set, any additional boxes must
-// fit within that height to be added. Boxes can be rotated to fit.
-//
-// The box coordinate system is very confusing. Here it is:
-//
-//  ! box x0, y0, w1, l1
-//  @ box x1, y0, w1, l3
-//
-//   (x + l)
-//   ^
-//
-// | !       |  > (y + w)
-// | @       |
-// | @       |
-// | @       |
-//
-type shelf struct {
-	// x starts at zero and changes with each box.
-	x uint8
-	// y is constant for shelf.
-	y uint8
-	// w is set by the first box.
-	w uint8
-	// l is the length of the box.
-	l uint8
-	// lRemains counts down with each box.
-	lRemains uint8
-}
-
-// newShelf initializes a new shelf at y position with length.
-func newShelf(y, l uint8) *shelf {
-	return &shelf{
-		x:        0,
-		y:        y,
-		l:        l,
-		lRemains: l,
-	}
-}
-
-// nextShelf returns a new empty shelf that sits on top of the current. A
-// non-zero value for the width sets the size of the shelf.
-func (s *shelf) nextShelf(w uint8) *shelf {
-	ns := newShelf(s.y+s.w, s.l)
-	ns.w = w
-	return ns
-}
-
-// add puts a box on the shelf if it fits. The box will be rotated to find the
-// best placement. If a fit is found, the shelf's positions are updated and
-// true is returned. Otherwise false is returned and the shelf is unchanged.
-func (s *shelf) add(b *box) bool {
-	if s.w == 0 {
-		sideways(b)
-		s.w = b.w
-		s.include(b)
-		return true
-	}
-	upright(b)
-	if b.w <= s.w && b.l <= s.lRemains {
-		s.include(b)
-		return true
-	}
-	sideways(b)
-	if b.w <= s.w && b.l <= s.lRemains {
-		s.include(b)
-		return true
-	}
-	return false
-}
-
-func (s *shelf) include(b *box) {
-	b.x, b.y = s.x, s.y
-	s.x += b.l
-	s.lRemains -= b.l
-}
-
-// packWithShelves fills a pallet with the shelf algorithm, using the boxes given. It
-// returns the boxes that were not put onto the pallet.
-func packWithShelves(pal *pallet, boxes []box) []box {
-	shelf := newShelf(0, palletLength)
-	wRemains := uint8(palletWidth)
-
-	if debug {
-		fmt.Printf("  Begin packing...\n")
-	}
-	for _, b := range boxes {
-		upright(&b)
-	}
-	sort.Sort(sortedBoxes(boxes))
-
-	usedBoxes := make(map[uint32]bool)
-
-	nextBox := func(maxW, maxL uint8) *box {
-		fmt.Printf("   nextBox maxW:%d, maxL:%d\n", maxW, maxL)
-		if maxW > 0 && maxL > 0 {
-			for _, b := range boxes {
-				if b.w <= maxW && b.l <= maxL && !usedBoxes[b.id] {
-					fmt.Printf("   nextBox W+L: %v\n", b)
-					return &b
-				}
-			}
-		}
-		if maxW > 0 {
-			for _, b := range boxes {
-				if b.w <= maxW && !usedBoxes[b.id] {
-					fmt.Printf("   nextBox W: %v\n", b)
-					return &b
-				}
-			}
-		}
-		if maxL > 0 {
-			for _, b := range boxes {
-				if b.l <= maxL && !usedBoxes[b.id] {
-					fmt.Printf("   nextBox L: %v\n", b)
-					return &b
-				}
-			}
-		}
-		for _, b := range boxes {
-			if !usedBoxes[b.id] {
-				fmt.Printf("   nextBox %v\n", b)
-				return &b
-			}
-		}
-		fmt.Printf("   nextBox nil")
-		return nil
-	}
-
-	for {
-		b := nextBox(shelf.w, shelf.lRemains)
-		if b == nil {
-			break
-		}
-		ok := shelf.add(b)
-		if ok {
-			if debug {
-				fmt.Printf("  + shelf %v, box %v\n", shelf, b)
-			}
-			usedBoxes[b.id] = true
-			pal.boxes = append(pal.boxes, *b)
-			if shelf.lRemains <= 0 {
-				fmt.Printf("shelf is full\n")
-				wRemains -= shelf.w
-				if wRemains <= 0 {
-					break
-				}
-				shelf = shelf.nextShelf(wRemains)
-			}
-		} else {
-			if debug {
-				fmt.Printf("  - shelf %v, box %v\n", shelf, b)
-			}
-			wRemains -= shelf.w
-			if wRemains <= 0 {
-				break
-			}
-			shelf = shelf.nextShelf(wRemains)
-		}
-	}
-
-	unusedBoxes := make([]box, 0, len(boxes))
-	for _, b := range boxes {
-		if !usedBoxes[b.id] {
-			unusedBoxes = append(unusedBoxes, b)
-		}
-	}
-	return unusedBoxes
-}
-
-func newRepacker(in <-chan *truck, out chan<- *truck) *repacker {
-	w := &warehouse{
-		trucks:        make(chan truck, 10),
-		boxes:         make([]box, 0, 2000),
-		hasBox:        make(map[uint32]bool),
-		truckCounter:  newCounter("Trucks"),
-		palletCounter: newCounter("Pallets"),
-		boxCounter:    newCounter("Boxes"),
-	}
-	go w.Unpack(in)
-	go func() {
-		for len(w.trucks) < cap(w.trucks) {
-			// wait
-		}
-		// The repacker must close channel out after it detects that
-		// channel in is closed so that the driver program will finish
-		// and print the stats.
-		defer close(out)
-		defer func() {
-			log.Printf("...\n")
-			log.Printf("%s\n", w.truckCounter)
-			log.Printf("%s\n", w.palletCounter)
-			log.Printf("%s\n", w.boxCounter)
-			log.Printf("...\n")
-		}()
-		for {
-			select {
-			case t := <-w.trucks:
-				if t.id == idLastTruck {
-					log.Printf("Packing the last truck...\n")
-					w.PackRemainingBoxes(&t)
-					out <- &t
-					return
-				}
-				w.PackTruck(&t)
-				out <- &t
-			}
-		}
-	}()
-	return &repacker{}
-}
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	debug = true
+)
+
+// A repacker repacks trucks.
+type repacker struct {
+}
+
+// counter keeps track of stuff going in and out of the warehouse.
+type counter struct {
+	Name    string
+	In, Out int
+}
+
+// newCounter initializes a counter with a name.
+func newCounter(name string) *counter {
+	return &counter{Name: name}
+}
+
+// Inc adds one to the "in" count.
+func (c *counter) Inc(a int) {
+	c.In += a
+}
+
+// Dec adds one to the "out" count.
+func (c *counter) Dec(a int) {
+	c.Out += a
+}
+
+// Missing is the difference between in and out.
+func (c *counter) Missing() int {
+	return c.In - c.Out
+}
+
+// String is a nice string describing the counter state.
+func (c *counter) String() string {
+	return fmt.Sprintf("%s: %d in, %d out (missing %d)", c.Name, c.In, c.Out, c.Missing())
+}
+
+// warehouse manages the ins and outs of unpacking and packing.
+type warehouse struct {
+	trucks        chan truck
+	boxes         []box
+	hasBox        map[uint32]bool
+	boxesMu       sync.Mutex
+	palletCounter *counter
+	truckCounter  *counter
+	boxCounter    *counter
+	packer        Packer
+	optimize      bool
+	rng           *rand.Rand
+	// ready is closed once enough trucks have arrived to start packing.
+	ready     chan struct{}
+	readyOnce sync.Once
+	// Trucks stop arriving at doneTime, and must all have left by
+	// finalTime.
+	doneTime, finalTime time.Time
+	// done is closed when the truck being packed runs out of time, so that
+	// packers that can give up early do.
+	done <-chan struct{}
+	// unpacked is closed once the last truck has been unpacked.
+	unpacked chan struct{}
+}
+
+// pack fills a pallet with the warehouse's packer, stacking boxes in layers
+// if the pallet is tall enough, keeping under its weight limit, and only
+// putting boxes together that palletRules allow.
+func (w *warehouse) pack(pal *pallet, boxes []box) []box {
+	p := w.packer
+	if p == nil {
+		p = packer
+	}
+	if c, ok := p.(cancelPacker); ok && w.done != nil {
+		p = PackerFunc(func(pal *pallet, boxes []box) []box {
+			return c.PackUntil(w.done, pal, boxes)
+		})
+	}
+	return packByRules(palletRules, underWeight(stacked(p)), pal, boxes)
+}
+
+func (w *warehouse) addBox(b box) {
+	w.boxesMu.Lock()
+	w.hasBox[b.id] = true
+	w.boxes = append(w.boxes, b)
+	w.boxCounter.Inc(1)
+	w.boxesMu.Unlock()
+}
+
+func (w *warehouse) grabSomeBoxes(max int) []box {
+	w.boxesMu.Lock()
+	if l := len(w.boxes); max > l {
+		max = l
+	}
+	out := make([]box, 0, max)
+	for _, b := range w.boxes {
+		if w.hasBox[b.id] {
+			delete(w.hasBox, b.id)
+			out = append(out, b)
+			w.boxCounter.Dec(1)
+			if len(out) > max {
+				break
+			}
+		}
+	}
+	w.boxesMu.Unlock()
+	return out
+}
+
+func (w *warehouse) grabAllBoxes() []box {
+	w.boxesMu.Lock()
+	out := make([]box, 0, len(w.boxes))
+	for _, b := range w.boxes {
+		if w.hasBox[b.id] {
+			delete(w.hasBox, b.id)
+			out = append(out, b)
+			w.boxCounter.Dec(1)
+		}
+	}
+	w.boxesMu.Unlock()
+	return out
+}
+
+func (w *warehouse) returnBoxes(boxes []box) {
+	w.boxesMu.Lock()
+	for _, b := range boxes {
+		w.hasBox[b.id] = true
+		w.boxCounter.Inc(1)
+	}
+	w.boxesMu.Unlock()
+}
+
+// Unpack unloads all boxes from the trucks, and parks all of the trucks to be
+// re-packed.
+func (w *warehouse) Unpack(in <-chan *truck) {
+	// Close trucks after consuming everything.
+	defer close(w.trucks)
+	defer close(w.unpacked)
+	defer w.setReady()
+	for t := range in {
+		emptyTruck := &truck{
+			id:      t.id,
+			pallets: make([]pallet, 0, len(t.pallets)),
+			size:    t.size,
+		}
+		w.trucks <- *emptyTruck
+		w.truckCounter.Inc(1)
+		for _, p := range t.pallets {
+			w.palletCounter.Inc(1)
+			for _, b := range p.boxes {
+				w.addBox(b)
+			}
+		}
+		// Start packing once the parking lot is full, or the last truck
+		// is in.
+		if len(w.trucks) == cap(w.trucks) || t.id == idLastTruck {
+			w.setReady()
+		}
+	}
+}
+
+// allUnpacked returns true once no more trucks are coming.
+func (w *warehouse) allUnpacked() bool {
+	select {
+	case <-w.unpacked:
+		return true
+	default:
+		return false
+	}
+}
+
+// setReady lets packing start.
+func (w *warehouse) setReady() {
+	w.readyOnce.Do(func() { close(w.ready) })
+}
+
+// PackTruck re-packs a truck as efficiently as possible.
+func (w *warehouse) PackTruck(t *truck) {
+	w.truckCounter.Dec(1)
+	deadline := w.truckDeadline()
+	defer w.packUntil(deadline)()
+	// Searching would hold up the trucks behind, so it waits until they're
+	// all in.
+	if w.optimize && w.allUnpacked() {
+		w.optimizeTruck(t, deadline)
+		return
+	}
+	// Pack up to the truck's pallet capacity.
+	for len(t.pallets) < cap(t.pallets) {
+		if debug {
+			fmt.Printf("Packing truck %d pallet %d\n", t.id, len(t.pallets))
+		}
+		p := w.packOnePallet(t.dims())
+		// If the pallet comes back empty we're done.
+		if len(p.boxes) == 0 {
+			return
+		}
+		w.palletCounter.Dec(1)
+		w.boxCounter.Dec(len(p.boxes))
+		t.pallets = append(t.pallets, *p)
+	}
+}
+
+// optimizeTruck fills the truck's pallets all at once with the truck
+// optimizer, instead of one pallet at a time. It searches until the
+// deadline. Every pallet with boxes on it ships, since boxes held back
+// would only pile up for the last truck.
+func (w *warehouse) optimizeTruck(t *truck, deadline time.Time) {
+	boxes := w.grabSomeBoxes(maxBoxes)
+	size := t.dims()
+	pallets, unusedBoxes := optimizeTruck(PackerFunc(w.pack), size, boxes, cap(t.pallets)-len(t.pallets), 1, deadline, w.rng)
+	w.returnBoxes(unusedBoxes)
+	if debug {
+		fmt.Printf("Optimized truck %d: %d pallets, %d of %d boxes\n", t.id, len(pallets), len(boxes)-len(unusedBoxes), len(boxes))
+	}
+	for _, p := range pallets {
+		w.palletCounter.Dec(1)
+		w.boxCounter.Dec(len(p.boxes))
+		t.pallets = append(t.pallets, *p)
+	}
+}
+
+// Searching stops for good once only 1/anytimeMargin of the time between
+// doneTime and finalTime is left.
+const anytimeMargin = 10
+
+// truckDeadline returns when packing the current truck must stop. The time
+// until doneTime is shared between the trucks that are waiting, so that the
+// warehouse keeps up with the trucks arriving. Once they're all in, the
+// time until the last deadline is shared instead.
+func (w *warehouse) truckDeadline() time.Time {
+	if w.finalTime.IsZero() {
+		return time.Now()
+	}
+	end := w.doneTime
+	if w.allUnpacked() {
+		end = w.lastDeadline()
+	}
+	return time.Now().Add(time.Until(end) / time.Duration(len(w.trucks)+1))
+}
+
+// lastDeadline returns when the search for the last truck must stop.
+func (w *warehouse) lastDeadline() time.Time {
+	if w.finalTime.IsZero() {
+		return time.Now()
+	}
+	return w.finalTime.Add(-w.finalTime.Sub(w.doneTime) / anytimeMargin)
+}
+
+// packUntil makes the packer give up at the deadline, if it can, until the
+// returned function is called. Without a final time there is no deadline.
+func (w *warehouse) packUntil(deadline time.Time) (stop func()) {
+	if w.finalTime.IsZero() {
+		return func() {}
+	}
+	done := make(chan struct{})
+	timer := time.AfterFunc(time.Until(deadline), func() { close(done) })
+	w.done = done
+	return func() {
+		timer.Stop()
+		w.done = nil
+	}
+}
+
+// PackRemainingBoxes puts all remaining boxes onto this last truck, with no
+// regard for how many pallets should fit.
+func (w *warehouse) PackRemainingBoxes(t *truck) {
+	w.truckCounter.Dec(1)
+	defer w.packUntil(w.lastDeadline())()
+	pallets := w.packAllBoxes(t.dims())
+	if w.optimize {
+		pallets = w.shrinkPallets(t.dims(), pallets)
+	}
+	for _, p := range pallets {
+		w.palletCounter.Dec(1)
+		w.boxCounter.Dec(len(p.boxes))
+		t.pallets = append(t.pallets, *p)
+	}
+}
+
+// shrinkPallets tries to fit the boxes onto one pallet fewer, until it can't
+// or time runs out. It always returns a valid packing.
+func (w *warehouse) shrinkPallets(size palletSize, pallets []*pallet) []*pallet {
+	var boxes []box
+	for _, p := range pallets {
+		boxes = append(boxes, p.boxes...)
+	}
+	deadline := w.lastDeadline()
+	for len(pallets) > 1 && time.Now().Before(deadline) {
+		fewer, left := optimizeTruck(PackerFunc(w.pack), size, boxes, len(pallets)-1, 1, deadline, w.rng)
+		if len(left) > 0 {
+			break
+		}
+		if debug {
+			fmt.Printf("Shrunk the last truck to %d pallets\n", len(fewer))
+		}
+		pallets = fewer
+	}
+	return pallets
+}
+
+const (
+	maxBoxes = 10000
+)
+
+// packer is the placement strategy used by new warehouses.
+var packer Packer = PackerFunc(packWithShelves)
+
+// optimizeTrucks makes new warehouses fill each truck with the truck
+// optimizer.
+var optimizeTrucks = true
+
+// packOnePallet pulls boxes from the channel, packs as many as it can onto one
+// pallet of the given size, then returns any unpacked boxes back to the
+// channel. It returns the packed pallet.
+func (w *warehouse) packOnePallet(size palletSize) *pallet {
+	if debug {
+		fmt.Printf("Packing...\n")
+	}
+
+	// Pack a pallet.
+	pal := newPallet(size)
+	boxes := w.grabSomeBoxes(maxBoxes)
+	unusedBoxes := w.pack(pal, boxes)
+	w.returnBoxes(unusedBoxes)
+
+	if debug {
+		fmt.Printf("Packed %d of %d boxes on pallet\n", len(pal.boxes), len(boxes))
+		for _, b := range pal.boxes {
+			fmt.Printf("  box %d: x%d, y%d, l%d, w%d\n", b.id, b.x, b.y, b.l, b.w)
+		}
+		fmt.Printf("%s\n", pal)
+	}
+
+	return pal
+}
+
+// packAllBoxes pulls all boxes from the channel and packs them onto pallets
+// of the given size until they are all packed. It returns all of the packed
+// pallets.
+func (w *warehouse) packAllBoxes(size palletSize) []*pallet {
+	// Pack until all of the boxes are used.
+	boxes := w.grabAllBoxes()
+	pallets := make([]*pallet, 0, len(boxes))
+	for len(boxes) > 0 {
+		pal := newPallet(size)
+		boxes = w.pack(pal, boxes)
+		// A box that fits nowhere still has to leave on some pallet.
+		if len(pal.boxes) == 0 {
+			pal.boxes = append(pal.boxes, boxes[0])
+			boxes = boxes[1:]
+		}
+		pallets = append(pallets, pal)
+	}
+	return pallets
+}
+
+type sortedBoxes []box
+
+func (boxes sortedBoxes) Len() int {
+	return len(boxes)
+}
+func (boxes sortedBoxes) Less(i, j int) bool {
+	a, b := boxes[i], boxes[j]
+	if a.w == b.w {
+		return a.l < b.l
+	}
+	return a.w > b.w
+}
+func (boxes sortedBoxes) Swap(i, j int) {
+	boxes[i], boxes[j] = boxes[j], boxes[i]
+}
+
+// sideways orients the box sideways, unless it is locked.
+func sideways(b *box) {
+	if b.w > b.l && !b.locked {
+		b.w, b.l = b.l, b.w
+	}
+}
+
+// upright orients the box upright, unless it is locked.
+func upright(b *box) {
+	if b.w < b.l && !b.locked {
+		b.w, b.l = b.l, b.w
+	}
+}
+
+// shelf models a horizontal plane of boxes. The height of the shelf is
+// determined by the first box. Once a height is set, any additional boxes must
+// fit within that height to be added. Boxes can be rotated to fit.
+//
+// The box coordinate system is very confusing. Here it is:
+//
+//  ! box x0, y0, w1, l1
+//  @ box x1, y0, w1, l3
+//
+//   (x + l)
+//   ^
+//
+// | !       |  > (y + w)
+// | @       |
+// | @       |
+// | @       |
+//
+type shelf struct {
+	// x starts at zero and changes with each box.
+	x uint8
+	// y is constant for shelf.
+	y uint8
+	// w is set by the first box.
+	w uint8
+	// l is the length of the box.
+	l uint8
+	// lRemains counts down with each box.
+	lRemains uint8
+}
+
+// newShelf initializes a new shelf at y position with length.
+func newShelf(y, l uint8) *shelf {
+	return &shelf{
+		x:        0,
+		y:        y,
+		l:        l,
+		lRemains: l,
+	}
+}
+
+// nextShelf returns a new empty shelf that sits on top of the current. A
+// non-zero value for the width sets the size of the shelf.
+func (s *shelf) nextShelf(w uint8) *shelf {
+	ns := newShelf(s.y+s.w, s.l)
+	ns.w = w
+	return ns
+}
+
+// add puts a box on the shelf if it fits. The box will be rotated to find the
+// best placement. If a fit is found, the shelf's positions are updated and
+// true is returned. Otherwise false is returned and the shelf is unchanged.
+func (s *shelf) add(b *box) bool {
+	if s.w == 0 {
+		sideways(b)
+		// Too long for the shelf lying down, so it has to stand up.
+		if b.l > s.lRemains {
+			upright(b)
+		}
+		s.w = b.w
+		s.include(b)
+		return true
+	}
+	upright(b)
+	if b.w <= s.w && b.l <= s.lRemains {
+		s.include(b)
+		return true
+	}
+	sideways(b)
+	if b.w <= s.w && b.l <= s.lRemains {
+		s.include(b)
+		return true
+	}
+	return false
+}
+
+func (s *shelf) include(b *box) {
+	b.x, b.y = s.x, s.y
+	s.x += b.l
+	s.lRemains -= b.l
+}
+
+// packWithShelves fills a pallet with the shelf algorithm, using the boxes given. It
+// returns the boxes that were not put onto the pallet.
+func packWithShelves(pal *pallet, boxes []box) []box {
+	size := pal.dims()
+	shelf := newShelf(0, size.w)
+	wRemains := size.l
+
+	if debug {
+		fmt.Printf("  Begin packing...\n")
+	}
+	for _, b := range boxes {
+		upright(&b)
+	}
+	sort.Sort(sortedBoxes(boxes))
+
+	// Boxes too big for the pallet are never used.
+	tooBig := make([]box, 0)
+	fit := make([]box, 0, len(boxes))
+	for _, b := range boxes {
+		if size.holds(b) {
+			fit = append(fit, b)
+		} else {
+			tooBig = append(tooBig, b)
+		}
+	}
+	boxes = fit
+
+	usedBoxes := make(map[uint32]bool)
+
+	nextBox := func(maxW, maxL uint8) *box {
+		fmt.Printf("   nextBox maxW:%d, maxL:%d\n", maxW, maxL)
+		if maxW > 0 && maxL > 0 {
+			for _, b := range boxes {
+				if b.w <= maxW && b.l <= maxL && !usedBoxes[b.id] {
+					fmt.Printf("   nextBox W+L: %v\n", b)
+					return &b
+				}
+			}
+		}
+		if maxW > 0 {
+			for _, b := range boxes {
+				if b.w <= maxW && !usedBoxes[b.id] {
+					fmt.Printf("   nextBox W: %v\n", b)
+					return &b
+				}
+			}
+		}
+		if maxL > 0 {
+			for _, b := range boxes {
+				if b.l <= maxL && !usedBoxes[b.id] {
+					fmt.Printf("   nextBox L: %v\n", b)
+					return &b
+				}
+			}
+		}
+		for _, b := range boxes {
+			if !usedBoxes[b.id] {
+				fmt.Printf("   nextBox %v\n", b)
+				return &b
+			}
+		}
+		fmt.Printf("   nextBox nil")
+		return nil
+	}
+
+	for {
+		b := nextBox(shelf.w, shelf.lRemains)
+		if b == nil {
+			break
+		}
+		ok := shelf.add(b)
+		if ok {
+			if debug {
+				fmt.Printf("  + shelf %v, box %v\n", shelf, b)
+			}
+			usedBoxes[b.id] = true
+			pal.boxes = append(pal.boxes, *b)
+			if shelf.lRemains <= 0 {
+				fmt.Printf("shelf is full\n")
+				wRemains -= shelf.w
+				if wRemains <= 0 {
+					break
+				}
+				shelf = shelf.nextShelf(wRemains)
+			}
+		} else {
+			if debug {
+				fmt.Printf("  - shelf %v, box %v\n", shelf, b)
+			}
+			wRemains -= shelf.w
+			if wRemains <= 0 {
+				break
+			}
+			shelf = shelf.nextShelf(wRemains)
+		}
+	}
+
+	unusedBoxes := make([]box, 0, len(boxes)+len(tooBig))
+	for _, b := range boxes {
+		if !usedBoxes[b.id] {
+			unusedBoxes = append(unusedBoxes, b)
+		}
+	}
+	return append(unusedBoxes, tooBig...)
+}
+
+// newRepacker starts repacking the trucks from in, sending them to out.
+// Trucks stop arriving at doneTime, and the repacked trucks are no longer
+// counted after finalTime.
+func newRepacker(in <-chan *truck, out chan<- *truck, doneTime, finalTime time.Time) *repacker {
+	w := &warehouse{
+		trucks:        make(chan truck, 10),
+		boxes:         make([]box, 0, 2000),
+		hasBox:        make(map[uint32]bool),
+		truckCounter:  newCounter("Trucks"),
+		palletCounter: newCounter("Pallets"),
+		boxCounter:    newCounter("Boxes"),
+		packer:        packer,
+		optimize:      optimizeTrucks,
+		rng:           rand.New(rand.NewSource(1)),
+		doneTime:      doneTime,
+		finalTime:     finalTime,
+		ready:         make(chan struct{}),
+		unpacked:      make(chan struct{}),
+	}
+	go w.Unpack(in)
+	go func() {
+		<-w.ready
+		// The repacker must close channel out after it detects that
+		// channel in is closed so that the driver program will finish
+		// and print the stats.
+		defer close(out)
+		defer func() {
+			log.Printf("...\n")
+			log.Printf("%s\n", w.truckCounter)
+			log.Printf("%s\n", w.palletCounter)
+			log.Printf("%s\n", w.boxCounter)
+			log.Printf("...\n")
+		}()
+		for {
+			select {
+			case t := <-w.trucks:
+				if t.id == idLastTruck {
+					log.Printf("Packing the last truck...\n")
+					w.PackRemainingBoxes(&t)
+					out <- &t
+					return
+				}
+				w.PackTruck(&t)
+				out <- &t
+			}
+		}
+	}()
+	return &repacker{}
+}
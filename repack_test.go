@@ -6,10 +6,10 @@ import (
 )
 
 func Test_sortedBoxes(t *testing.T) {
-	a := box{0, 0, 5, 1, 91}
-	b := box{0, 0, 5, 2, 90}
-	c := box{0, 0, 4, 2, 92}
-	d := box{0, 0, 3, 2, 93}
+	a := box{x: 0, y: 0, w: 5, l: 1, id: 91}
+	b := box{x: 0, y: 0, w: 5, l: 2, id: 90}
+	c := box{x: 0, y: 0, w: 4, l: 2, id: 92}
+	d := box{x: 0, y: 0, w: 3, l: 2, id: 93}
 	gotBoxes := []box{c, b, d, a}
 	wantBoxes := []box{a, b, c, d}
 	sort.Sort(sortedBoxes(gotBoxes))
@@ -27,19 +27,19 @@ func TestOrientations(t *testing.T) {
 		wantSideways box
 	}{
 		{
-			have:         box{0, 0, 3, 5, 99},
-			wantUpright:  box{0, 0, 5, 3, 99},
-			wantSideways: box{0, 0, 3, 5, 99},
+			have:         box{x: 0, y: 0, w: 3, l: 5, id: 99},
+			wantUpright:  box{x: 0, y: 0, w: 5, l: 3, id: 99},
+			wantSideways: box{x: 0, y: 0, w: 3, l: 5, id: 99},
 		},
 		{
-			have:         box{0, 0, 5, 3, 99},
-			wantUpright:  box{0, 0, 5, 3, 99},
-			wantSideways: box{0, 0, 3, 5, 99},
+			have:         box{x: 0, y: 0, w: 5, l: 3, id: 99},
+			wantUpright:  box{x: 0, y: 0, w: 5, l: 3, id: 99},
+			wantSideways: box{x: 0, y: 0, w: 3, l: 5, id: 99},
 		},
 		{
-			have:         box{0, 0, 3, 3, 99},
-			wantUpright:  box{0, 0, 3, 3, 99},
-			wantSideways: box{0, 0, 3, 3, 99},
+			have:         box{x: 0, y: 0, w: 3, l: 3, id: 99},
+			wantUpright:  box{x: 0, y: 0, w: 3, l: 3, id: 99},
+			wantSideways: box{x: 0, y: 0, w: 3, l: 3, id: 99},
 		},
 	}
 	for _, test := range tests {
@@ -65,7 +65,7 @@ func Test_newShelf(t *testing.T) {
 
 func Test_shelf_nextShelf(t *testing.T) {
 	s := newShelf(1, 7)
-	s.add(&box{0, 0, 4, 2, 99})
+	s.add(&box{x: 0, y: 0, w: 4, l: 2, id: 99})
 	wantNow := shelf{4, 1, 2, 7, 3}
 	if *s != wantNow {
 		t.Errorf("got now: %v, want %v", s, wantNow)
@@ -103,29 +103,29 @@ func Test_shelf_add(t *testing.T) {
 	}{
 		{
 			// First box is sideways.
-			boxIn:  box{0, 0, 3, 2, 99},
-			boxOut: box{0, 1, 2, 3, 99},
+			boxIn:  box{x: 0, y: 0, w: 3, l: 2, id: 99},
+			boxOut: box{x: 0, y: 1, w: 2, l: 3, id: 99},
 			shelf:  shelf{3, 1, 2, 9, 6},
 			ok:     true,
 		},
 		{
 			// This box fits upright.
-			boxIn:  box{0, 0, 1, 2, 99},
-			boxOut: box{3, 1, 2, 1, 99},
+			boxIn:  box{x: 0, y: 0, w: 1, l: 2, id: 99},
+			boxOut: box{x: 3, y: 1, w: 2, l: 1, id: 99},
 			shelf:  shelf{4, 1, 2, 9, 5},
 			ok:     true,
 		},
 		{
 			// This box fits sideways.
-			boxIn:  box{0, 0, 4, 2, 99},
-			boxOut: box{4, 1, 2, 4, 99},
+			boxIn:  box{x: 0, y: 0, w: 4, l: 2, id: 99},
+			boxOut: box{x: 4, y: 1, w: 2, l: 4, id: 99},
 			shelf:  shelf{8, 1, 2, 9, 1},
 			ok:     true,
 		},
 		{
 			// This box does not fit.
-			boxIn:  box{0, 0, 1, 3, 99},
-			boxOut: box{0, 0, 1, 3, 99},
+			boxIn:  box{x: 0, y: 0, w: 1, l: 3, id: 99},
+			boxOut: box{x: 0, y: 0, w: 1, l: 3, id: 99},
 			shelf:  shelf{8, 1, 2, 9, 1},
 			ok:     false,
 		},
@@ -147,7 +147,7 @@ func Test_shelf_add(t *testing.T) {
 
 func Test_shelf_include(t *testing.T) {
 	s := newShelf(1, 4)
-	b := box{0, 0, 3, 2, 99}
+	b := box{x: 0, y: 0, w: 3, l: 2, id: 99}
 	s.include(&b)
 	if got, want := s.x, uint8(2); got != want {
 		t.Errorf("shelf.x got %d, want %d", got, want)
@@ -169,12 +169,12 @@ func Test_shelf_include(t *testing.T) {
 func Test_packPallet(t *testing.T) {
 	boxes := make([]box, 0)
 	w := warehouse{boxes: boxes}
-	boxes = append(boxes, box{0, 0, 2, 1, 90})
-	boxes = append(boxes, box{0, 0, 1, 1, 91})
-	boxes = append(boxes, box{0, 0, 1, 3, 92})
-	boxes = append(boxes, box{0, 0, 2, 1, 93})
-	boxes = append(boxes, box{0, 0, 1, 1, 94})
-	pal := w.packOnePallet()
+	boxes = append(boxes, box{x: 0, y: 0, w: 2, l: 1, id: 90})
+	boxes = append(boxes, box{x: 0, y: 0, w: 1, l: 1, id: 91})
+	boxes = append(boxes, box{x: 0, y: 0, w: 1, l: 3, id: 92})
+	boxes = append(boxes, box{x: 0, y: 0, w: 2, l: 1, id: 93})
+	boxes = append(boxes, box{x: 0, y: 0, w: 1, l: 1, id: 94})
+	pal := w.packOnePallet(defaultPalletSize)
 	if err := pal.IsValid(); err != nil {
 		t.Fatalf("Pallet is not packed correctly: %s", err)
 	}
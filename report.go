@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"sort"
+)
+
+// A truckReport is what the HTML report shows about one truck: the pallets
+// it came in with, the pallets it left with, and what went wrong.
+type truckReport struct {
+	ID       int
+	Profit   int
+	Bound    int
+	In, Out  []palletReport
+	Failures []string
+}
+
+// A palletReport is one pallet drawn as SVG, with how full it is.
+type palletReport struct {
+	SVG   template.HTML
+	Fill  float64
+	Items int
+	Error string
+}
+
+// A runReport collects the results of a run for the HTML report.
+type runReport struct {
+	Trucks   []truckReport
+	Profit   int
+	Items    int
+	Failures []string
+}
+
+// add records a result. inbound is the pallets the truck came in with.
+func (rep *runReport) add(r result, inbound []pallet) {
+	rep.Profit += r.profit
+	rep.Items += r.items
+	if r.truck == nil {
+		rep.Failures = append(rep.Failures, failureMessages(r.failures)...)
+		return
+	}
+	tr := truckReport{
+		ID:       r.truck.id,
+		Profit:   r.profit,
+		Bound:    r.bound.pallets(),
+		In:       palletReports(inbound, r.size),
+		Out:      palletReports(r.truck.pallets, r.size),
+		Failures: failureMessages(r.failures),
+	}
+	rep.Trucks = append(rep.Trucks, tr)
+}
+
+// failureMessages returns what each failure says.
+func failureMessages(fs []failure) []string {
+	msgs := make([]string, len(fs))
+	for i, f := range fs {
+		msgs[i] = f.msg
+	}
+	return msgs
+}
+
+// palletReports draws each pallet, at the size of the truck's pallets.
+func palletReports(pallets []pallet, size palletSize) []palletReport {
+	reports := make([]palletReport, len(pallets))
+	for i, p := range pallets {
+		p.size = size
+		pr := palletReport{Items: p.Items()}
+		if v := p.dims().volume(); v > 0 {
+			pr.Fill = 100 * float64(p.Volume()) / float64(v)
+		}
+		if err := p.IsValid(); err != nil {
+			pr.Error = err.Error()
+		}
+		caption := fmt.Sprintf("pallet %d", i)
+		var buf bytes.Buffer
+		drawPanels([]renderPanel{{caption: caption, pal: p}}).writeSVG(&buf)
+		pr.SVG = template.HTML(buf.String())
+		reports[i] = pr
+	}
+	return reports
+}
+
+// write writes the report as a standalone HTML page, with the trucks in
+// order of id.
+func (rep *runReport) write(w io.Writer) error {
+	sort.SliceStable(rep.Trucks, func(i, j int) bool {
+		return rep.Trucks[i].ID < rep.Trucks[j].ID
+	})
+	return reportTemplate.Execute(w, rep)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Repacking report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+.truck { border-top: 1px solid #ccc; padding: 1em 0; }
+.sides { display: flex; gap: 3em; }
+.pallets { display: flex; flex-wrap: wrap; gap: 1em; align-items: flex-start; }
+.pallet p { margin: 0.2em 0; font-size: small; }
+.fail { color: #c00; }
+</style>
+</head>
+<body>
+<h1>Repacking report</h1>
+<p>{{len .Trucks}} trucks, {{.Items}} items repacked, profit {{.Profit}}.</p>
+{{range .Failures}}<p class="fail">{{.}}</p>
+{{end}}
+{{range .Trucks}}<div class="truck">
+<h2>Truck {{.ID}}: {{len .In}} pallets in, {{len .Out}} out (at least {{.Bound}} needed), profit {{.Profit}}</h2>
+{{range .Failures}}<p class="fail">{{.}}</p>
+{{end}}<div class="sides">
+<div><h3>Inbound</h3><div class="pallets">
+{{range .In}}<div class="pallet">{{.SVG}}<p>{{.Items}} items, {{printf "%.1f" .Fill}}% full</p>{{if .Error}}<p class="fail">{{.Error}}</p>{{end}}</div>
+{{end}}</div></div>
+<div><h3>Repacked</h3><div class="pallets">
+{{range .Out}}<div class="pallet">{{.SVG}}<p>{{.Items}} items, {{printf "%.1f" .Fill}}% full</p>{{if .Error}}<p class="fail">{{.Error}}</p>{{end}}</div>
+{{end}}</div></div>
+</div>
+</div>
+{{end}}</body>
+</html>
+`))
+
+// writeReport writes the report to the named file.
+func writeReport(name string, rep *runReport) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := rep.write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
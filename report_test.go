@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_runReport(t *testing.T) {
+	in := []pallet{
+		{boxes: []box{{x: 0, y: 0, w: 2, l: 2, id: 101}}},
+		{boxes: []box{{x: 0, y: 0, w: 2, l: 2, id: 102}}},
+	}
+	out := &truck{id: 5, pallets: []pallet{{boxes: []box{
+		{x: 0, y: 0, w: 2, l: 2, id: 101},
+		{x: 0, y: 2, w: 2, l: 2, id: 102},
+	}}}}
+
+	rep := &runReport{}
+	rep.add(result{profit: 1, items: 2, truck: out, size: palletSize{w: 4, l: 4}}, in)
+	rep.add(result{fail: true, failures: []failure{{reason: failNotSeen, msg: "3 boxes not seen in the departing trucks"}}}, nil)
+
+	if rep.Profit != 1 || rep.Items != 2 || len(rep.Trucks) != 1 {
+		t.Fatalf("report has profit %d, %d items, %d trucks", rep.Profit, rep.Items, len(rep.Trucks))
+	}
+	tr := rep.Trucks[0]
+	if len(tr.In) != 2 || len(tr.Out) != 1 {
+		t.Fatalf("%d pallets in, %d out", len(tr.In), len(tr.Out))
+	}
+	if tr.In[0].Fill != 25 || tr.Out[0].Fill != 50 {
+		t.Errorf("fill %.1f%% in, %.1f%% out", tr.In[0].Fill, tr.Out[0].Fill)
+	}
+
+	var buf bytes.Buffer
+	if err := rep.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	html := buf.String()
+	for _, want := range []string{"Truck 5", "profit 1", "<svg", "50.0% full", "3 boxes not seen"} {
+		if !strings.Contains(html, want) {
+			t.Errorf("report has no %q", want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+)
+
+// Reasons a run fails, as they appear in the results.
+const (
+	failNotInInput   = "box_not_in_input"
+	failRotated      = "locked_box_rotated"
+	failOverlap      = "overlap"
+	failEdge         = "off_edge"
+	failOverweight   = "overweight"
+	failCrushed      = "crushed"
+	failFloating     = "floating"
+	failRule         = "rule"
+	failInvalid      = "invalid"
+	failUnknownTruck = "unknown_truck"
+	failNotSeen      = "boxes_not_seen"
+	failNotDelivered = "not_delivered"
+)
+
+// Formats for the results of a run.
+const (
+	resultsText = "text"
+	resultsJSON = "json"
+)
+
+// A failure is one thing that went wrong in a run.
+type failure struct {
+	reason string
+	msg    string
+}
+
+// failf logs a problem, and marks the result as failed.
+func (r *result) failf(reason, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	log.Print(msg)
+	r.failures = append(r.failures, failure{reason: reason, msg: msg})
+	r.fail = true
+}
+
+// palletFailure returns the reason a pallet is not correctly packed.
+func palletFailure(err error) string {
+	switch err.(type) {
+	case errOverlap:
+		return failOverlap
+	case errEdge:
+		return failEdge
+	case errOverweight:
+		return failOverweight
+	case errCrushed:
+		return failCrushed
+	case errFloating:
+		return failFloating
+	case errRule:
+		return failRule
+	}
+	return failInvalid
+}
+
+type jsonFailure struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+type jsonTruckResult struct {
+	ID         int     `json:"id"`
+	PalletsIn  int     `json:"palletsIn"`
+	PalletsOut int     `json:"palletsOut"`
+	Profit     int     `json:"profit"`
+	Items      int     `json:"items"`
+	ElapsedMS  float64 `json:"elapsedMs"`
+	// Bound is the fewest pallets the boxes the truck left with could need,
+	// and Gap is how many more it took.
+	Bound    int           `json:"boundPallets"`
+	Gap      int           `json:"gap"`
+	Failures []jsonFailure `json:"failures,omitempty"`
+}
+
+// runResults is the summary of a run, written as JSON.
+type runResults struct {
+	OK           bool    `json:"ok"`
+	Trucks       int     `json:"trucks"`
+	Items        int     `json:"items"`
+	Profit       int     `json:"profit"`
+	Weight       int     `json:"weight,omitempty"`
+	Capacity     int     `json:"capacity,omitempty"`
+	ElapsedMS    float64 `json:"elapsedMs"`
+	Timeout      bool    `json:"timeout"`
+	FinalTimeout bool    `json:"finalTimeout"`
+	// PalletsOut is how many pallets the repacked trucks left with, and
+	// Bound the fewest that their boxes could need. InputBound is the
+	// fewest that all of the input could need, so InputGap also counts
+	// boxes that were never delivered.
+	PalletsOut int               `json:"palletsOut"`
+	Bound      int               `json:"boundPallets"`
+	Gap        int               `json:"gap"`
+	InputBound int               `json:"inputBoundPallets"`
+	InputGap   int               `json:"inputGap"`
+	PerTruck   []jsonTruckResult `json:"perTruck"`
+	// Failures are the ones that aren't about one truck.
+	Failures []jsonFailure `json:"failures,omitempty"`
+	// Skipped are the trucks that couldn't be read, in lenient mode.
+	Skipped []jsonSkipped `json:"skipped,omitempty"`
+}
+
+type jsonSkipped struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Truck   int    `json:"truck"`
+	Message string `json:"message"`
+}
+
+// skip records the trucks that couldn't be read.
+func (rs *runResults) skip(errs []*ParseError) {
+	for _, e := range errs {
+		rs.Skipped = append(rs.Skipped, jsonSkipped{
+			Line:    e.Line,
+			Column:  e.Column,
+			Truck:   e.Truck,
+			Message: e.Err.Error(),
+		})
+	}
+}
+
+func jsonFailures(fs []failure) []jsonFailure {
+	if len(fs) == 0 {
+		return nil
+	}
+	out := make([]jsonFailure, len(fs))
+	for i, f := range fs {
+		out[i] = jsonFailure{Reason: f.reason, Message: f.msg}
+	}
+	return out
+}
+
+// add records a result.
+func (rs *runResults) add(r result) {
+	rs.Items += r.items
+	rs.Profit += r.profit
+	rs.Weight += r.weight
+	rs.Capacity += r.capacity
+	if r.truck == nil {
+		rs.Failures = append(rs.Failures, jsonFailures(r.failures)...)
+		return
+	}
+	rs.Trucks++
+	rs.PerTruck = append(rs.PerTruck, jsonTruckResult{
+		ID:         r.truck.id,
+		PalletsIn:  r.pallets,
+		PalletsOut: len(r.truck.pallets),
+		Profit:     r.profit,
+		Items:      r.items,
+		ElapsedMS:  ms(r.elapsed),
+		Bound:      r.bound.pallets(),
+		Gap:        len(r.truck.pallets) - r.bound.pallets(),
+		Failures:   jsonFailures(r.failures),
+	})
+}
+
+// bound records the pallets that left, against the fewest their boxes could
+// need and the fewest all of the input could need.
+func (rs *runResults) bound(pallets int, shipped, input palletBound) {
+	rs.PalletsOut = pallets
+	rs.Bound = shipped.pallets()
+	rs.Gap = pallets - shipped.pallets()
+	rs.InputBound = input.pallets()
+	rs.InputGap = pallets - input.pallets()
+}
+
+// ms returns a duration in milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// write writes the results as indented JSON.
+func (rs *runResults) write(w io.Writer) error {
+	if rs.PerTruck == nil {
+		rs.PerTruck = []jsonTruckResult{}
+	}
+	buf, err := json.MarshalIndent(rs, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(buf, '\n'))
+	return err
+}
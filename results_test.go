@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func Test_palletFailure(t *testing.T) {
+	cases := []struct {
+		boxes []box
+		want  string
+	}{
+		{[]box{{x: 0, y: 0, w: 2, l: 2, id: 1}, {x: 1, y: 1, w: 1, l: 1, id: 2}}, failOverlap},
+		{[]box{{x: 3, y: 3, w: 2, l: 1, id: 1}}, failEdge},
+		{[]box{{x: 0, y: 0, z: 1, w: 1, l: 1, id: 1}}, failFloating},
+	}
+	for _, c := range cases {
+		err := pallet{boxes: c.boxes}.IsValid()
+		if err == nil {
+			t.Errorf("%v is valid", c.boxes)
+			continue
+		}
+		if got := palletFailure(err); got != c.want {
+			t.Errorf("%v: reason %q, want %q", err, got, c.want)
+		}
+	}
+}
+
+func Test_runResults(t *testing.T) {
+	rs := &runResults{}
+	ok := result{
+		profit: 2, items: 10, pallets: 5, elapsed: 1500 * time.Microsecond,
+		truck: &truck{id: 7, pallets: make([]pallet, 3)},
+	}
+	bad := result{truck: &truck{id: 8}}
+	bad.failf(failUnknownTruck, "truck %v unknown", 8)
+	lost := result{}
+	lost.failf(failNotSeen, "%v boxes not seen in the departing trucks", 4)
+	for _, r := range []result{ok, bad, lost} {
+		rs.add(r)
+	}
+
+	var buf bytes.Buffer
+	if err := rs.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var got runResults
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Trucks != 2 || got.Items != 10 || got.Profit != 2 {
+		t.Errorf("%d trucks, %d items, profit %d", got.Trucks, got.Items, got.Profit)
+	}
+	if len(got.PerTruck) != 2 {
+		t.Fatalf("%d trucks", len(got.PerTruck))
+	}
+	tr := got.PerTruck[0]
+	if tr.ID != 7 || tr.PalletsIn != 5 || tr.PalletsOut != 3 || tr.ElapsedMS != 1.5 {
+		t.Errorf("truck %+v", tr)
+	}
+	if f := got.PerTruck[1].Failures; len(f) != 1 || f[0].Reason != failUnknownTruck {
+		t.Errorf("truck 8 failures %+v", f)
+	}
+	if len(got.Failures) != 1 || got.Failures[0].Reason != failNotSeen {
+		t.Errorf("failures %+v", got.Failures)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A rule forbids boxes with two values of one attribute from sharing a
+// pallet, like two hazard classes that can't travel together.
+type rule struct {
+	attr string
+	a, b uint8
+}
+
+func (r rule) String() string {
+	return fmt.Sprintf("%s %d with %s %d", r.attr, r.a, r.attr, r.b)
+}
+
+// ruleAttrs are the box attributes that rules can be made for.
+var ruleAttrs = map[string]func(box) uint8{
+	"hazard": func(b box) uint8 { return b.hazard },
+	"temp":   func(b box) uint8 { return b.temp },
+}
+
+// breaks returns true if boxes x and y can't share a pallet by this rule.
+func (r rule) breaks(x, y box) bool {
+	get := ruleAttrs[r.attr]
+	vx, vy := get(x), get(y)
+	return (vx == r.a && vy == r.b) || (vx == r.b && vy == r.a)
+}
+
+// A ruleSet is the rules every pallet must follow.
+type ruleSet struct {
+	rules []rule
+}
+
+// palletRules are the rules checked by pallet.IsValid, and followed by the
+// warehouse. There are none unless they're loaded on the command line.
+var palletRules = &ruleSet{}
+
+// allowed returns true if boxes x and y may share a pallet. If not, it
+// returns the rule they break.
+func (rs *ruleSet) allowed(x, y box) (rule, bool) {
+	for _, r := range rs.rules {
+		if r.breaks(x, y) {
+			return r, false
+		}
+	}
+	return rule{}, true
+}
+
+// check returns an errRule for the first two boxes that can't share a
+// pallet, or nil.
+func (rs *ruleSet) check(boxes []box) error {
+	if len(rs.rules) == 0 {
+		return nil
+	}
+	for i := range boxes {
+		for j := i + 1; j < len(boxes); j++ {
+			if r, ok := rs.allowed(boxes[i], boxes[j]); !ok {
+				return errRule{a: i, b: j, rule: r}
+			}
+		}
+	}
+	return nil
+}
+
+// errRule is returned by pallet.IsValid for two boxes that break a rule.
+type errRule struct {
+	a, b int
+	rule rule
+}
+
+func (e errRule) Error() string {
+	return fmt.Sprintf("boxes %v and %v can't share a pallet (%v)", e.a, e.b, e.rule)
+}
+
+// errRuleLine is returned for a line of a rules file that can't be read.
+type errRuleLine struct {
+	line int
+	text string
+}
+
+func (e errRuleLine) Error() string {
+	return fmt.Sprintf("rules line %d: can't read %q", e.line, e.text)
+}
+
+// rulesFromReader reads a rules file. Each line is an attribute and two of
+// its values that can't share a pallet. Blank lines and lines starting with
+// # are skipped:
+//
+//	# Oxidizers and flammable liquids travel apart.
+//	hazard 3 5
+//	# Chilled boxes can't go with ambient ones.
+//	temp 1 0
+func rulesFromReader(r io.Reader) (*ruleSet, error) {
+	rs := &ruleSet{}
+	scn := bufio.NewScanner(r)
+	for n := 1; scn.Scan(); n++ {
+		text := strings.TrimSpace(scn.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		f := strings.Fields(text)
+		if len(f) != 3 || ruleAttrs[f[0]] == nil {
+			return nil, errRuleLine{line: n, text: text}
+		}
+		a, errA := strconv.ParseUint(f[1], 10, 8)
+		b, errB := strconv.ParseUint(f[2], 10, 8)
+		if errA != nil || errB != nil {
+			return nil, errRuleLine{line: n, text: text}
+		}
+		rs.rules = append(rs.rules, rule{attr: f[0], a: uint8(a), b: uint8(b)})
+	}
+	return rs, scn.Err()
+}
+
+// loadRules reads the rules file at path.
+func loadRules(path string) (*ruleSet, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return rulesFromReader(f)
+}
+
+// byRules returns a Packer that fills a pallet with p, only using boxes
+// that can share it.
+func byRules(rs *ruleSet, p Packer) Packer {
+	return PackerFunc(func(pal *pallet, boxes []box) []box {
+		return packByRules(rs, p, pal, boxes)
+	})
+}
+
+// packByRules fills a pallet with p, which doesn't know about the rules.
+// Boxes are picked biggest first, skipping any that can't share the pallet
+// with those already picked, and then packed. It returns the boxes that were
+// not put onto the pallet.
+func packByRules(rs *ruleSet, p Packer, pal *pallet, boxes []box) []box {
+	if len(rs.rules) == 0 {
+		return p.Pack(pal, boxes)
+	}
+
+	sorted := make([]box, len(boxes))
+	copy(sorted, boxes)
+	sort.Stable(byArea(sorted))
+
+	picked := append([]box(nil), pal.boxes...)
+	start := len(picked)
+	skipped := make([]box, 0)
+	for _, b := range sorted {
+		ok := true
+		for _, o := range picked {
+			if _, ok = rs.allowed(b, o); !ok {
+				break
+			}
+		}
+		if !ok {
+			skipped = append(skipped, b)
+			continue
+		}
+		picked = append(picked, b)
+	}
+	return append(p.Pack(pal, picked[start:]), skipped...)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_loadRules(t *testing.T) {
+	rs, err := loadRules("testdata/rules.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs.rules) != 7 {
+		t.Fatalf("got %d rules, want 7", len(rs.rules))
+	}
+	if want := (rule{attr: "temp", a: 2, b: 0}); rs.rules[6] != want {
+		t.Errorf("got %v, want %v", rs.rules[6], want)
+	}
+
+	for _, in := range []string{"hazard 1", "weight 1 2", "temp 1 x", "hazard 1 2 3"} {
+		_, err := rulesFromReader(strings.NewReader("# ok\n\n" + in))
+		if e, ok := err.(errRuleLine); !ok || e.line != 3 {
+			t.Errorf("%q: wrong err: %v", in, err)
+		}
+	}
+}
+
+func Test_ruleSet_check(t *testing.T) {
+	rs := &ruleSet{rules: []rule{{attr: "hazard", a: 3, b: 5}, {attr: "temp", a: 1, b: 0}}}
+	boxes := []box{
+		{w: 1, l: 1, id: 101, hazard: 3, temp: 1},
+		{w: 1, l: 1, id: 102, hazard: 3, temp: 1},
+		{w: 1, l: 1, id: 103, temp: 1},
+	}
+	if err := rs.check(boxes); err != nil {
+		t.Error(err)
+	}
+	boxes = append(boxes, box{w: 1, l: 1, id: 104, hazard: 5, temp: 1})
+	if err, ok := rs.check(boxes).(errRule); !ok || err.a != 0 || err.b != 3 {
+		t.Error("wrong err:", err)
+	}
+	boxes[3] = box{w: 1, l: 1, id: 104}
+	if err, ok := rs.check(boxes).(errRule); !ok || err.rule != rs.rules[1] {
+		t.Error("wrong err:", err)
+	}
+}
+
+func TestPalletRules(t *testing.T) {
+	defer func(rs *ruleSet) { palletRules = rs }(palletRules)
+	palletRules = &ruleSet{rules: []rule{{attr: "temp", a: 1, b: 0}}}
+
+	p := newPallet(palletSize{w: 4, l: 4})
+	p.boxes = []box{
+		{x: 0, y: 0, w: 1, l: 1, id: 101, temp: 1},
+		{x: 1, y: 0, w: 1, l: 1, id: 102},
+	}
+	if _, ok := p.IsValid().(errRule); !ok {
+		t.Error("wrong err:", p.IsValid())
+	}
+}
+
+func Test_packByRules(t *testing.T) {
+	rs := &ruleSet{rules: []rule{{attr: "hazard", a: 1, b: 2}}}
+	pal := newPallet(palletSize{w: 4, l: 4})
+	unused := packByRules(rs, PackerFunc(packWithMaxRects), pal, []box{
+		{w: 2, l: 2, id: 90, hazard: 1},
+		{w: 4, l: 2, id: 91, hazard: 2},
+		{w: 2, l: 2, id: 92},
+		{w: 2, l: 2, id: 93, hazard: 2},
+	})
+	if err := rs.check(pal.boxes); err != nil {
+		t.Error(err, pal)
+	}
+	// The biggest box goes first, so class 1 is left behind.
+	if len(unused) != 1 || unused[0].id != 90 {
+		t.Errorf("packed %v, left %v", pal.boxes, unused)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// skylineHeuristic decides where along the skyline a box is placed.
+type skylineHeuristic int
+
+const (
+	// Bottom-Left: keep the top of the box as low as possible.
+	skylineBL skylineHeuristic = iota
+	// Min Waste: leave as little area as possible under the box.
+	skylineMinWaste
+)
+
+func (h skylineHeuristic) String() string {
+	switch h {
+	case skylineBL:
+		return "bl"
+	case skylineMinWaste:
+		return "minwaste"
+	}
+	return fmt.Sprintf("skylineHeuristic(%d)", int(h))
+}
+
+// skylineNode is one flat segment of the skyline. It covers y to y+w, and
+// everything below x is taken.
+type skylineNode struct {
+	x    uint8
+	y, w uint8
+}
+
+// skyline tracks the top contour of the boxes on a pallet, as described in
+// section 3 of RectangleBinPack.pdf. Boxes are dropped onto the skyline
+// along x. The gaps that get covered can be kept in a waste map, and filled
+// later.
+type skyline struct {
+	heuristic skylineHeuristic
+	// w is the extent of the skyline along y, and l how far it can grow
+	// along x.
+	w, l  uint8
+	nodes []skylineNode
+	waste *guillotine
+}
+
+// newSkyline initializes an empty pallet of the given size. If wasteMap is
+// true, gaps under the skyline are kept for later boxes.
+func newSkyline(size palletSize, h skylineHeuristic, wasteMap bool) *skyline {
+	s := &skyline{
+		heuristic: h,
+		w:         size.l,
+		l:         size.w,
+		nodes:     []skylineNode{{x: 0, y: 0, w: size.l}},
+	}
+	if wasteMap {
+		s.waste = newGuillotine(size, guillotineBAF, guillotineSLAS, true)
+		s.waste.free = nil
+	}
+	return s
+}
+
+// fits returns the x position a box of width w would rest at if its left
+// edge is at node i, and the area it would leave wasted beneath it. If it
+// does not fit, ok is false.
+func (s *skyline) fits(i int, w, l uint8) (x uint8, waste int, ok bool) {
+	y := s.nodes[i].y
+	if int(y)+int(w) > int(s.w) {
+		return 0, 0, false
+	}
+	left := int(w)
+	for j := i; left > 0; j++ {
+		if s.nodes[j].x > x {
+			x = s.nodes[j].x
+		}
+		left -= int(s.nodes[j].w)
+	}
+	if int(x)+int(l) > int(s.l) {
+		return 0, 0, false
+	}
+	left = int(w)
+	for j := i; left > 0; j++ {
+		n := s.nodes[j]
+		span := int(n.w)
+		if span > left {
+			span = left
+		}
+		waste += span * int(x-n.x)
+		left -= int(n.w)
+	}
+	return x, waste, true
+}
+
+// find returns the best position on the skyline for the box, trying both
+// orientations. Lower scores are better. If the box does not fit, ok is
+// false.
+func (s *skyline) find(b box) (best box, s1, s2 int, ok bool) {
+	for i := range s.nodes {
+		for _, rot := range []func(*box){upright, sideways} {
+			c := b
+			rot(&c)
+			x, waste, fit := s.fits(i, c.w, c.l)
+			if !fit {
+				continue
+			}
+			a, z := int(x)+int(c.l), int(s.nodes[i].y)
+			if s.heuristic == skylineMinWaste {
+				a, z = waste, int(x)+int(c.l)
+			}
+			if !ok || a < s1 || (a == s1 && z < s2) {
+				c.x, c.y = x, s.nodes[i].y
+				best, s1, s2, ok = c, a, z, true
+			}
+		}
+	}
+	return
+}
+
+// place drops the box onto the skyline, raising the contour beneath it.
+func (s *skyline) place(b box) {
+	if s.waste != nil {
+		s.addWaste(b)
+	}
+
+	nodes := make([]skylineNode, 0, len(s.nodes)+2)
+	top := skylineNode{x: b.x + b.l, y: b.y, w: b.w}
+	added := false
+	for _, n := range s.nodes {
+		end := n.y + n.w
+		if end <= top.y || n.y >= top.y+top.w {
+			if !added && n.y >= top.y+top.w {
+				nodes = append(nodes, top)
+				added = true
+			}
+			nodes = append(nodes, n)
+			continue
+		}
+		// Keep the parts of n that stick out either side of the box.
+		if n.y < top.y {
+			nodes = append(nodes, skylineNode{x: n.x, y: n.y, w: top.y - n.y})
+		}
+		if !added {
+			nodes = append(nodes, top)
+			added = true
+		}
+		if end > top.y+top.w {
+			nodes = append(nodes, skylineNode{x: n.x, y: top.y + top.w, w: end - top.y - top.w})
+		}
+	}
+	if !added {
+		nodes = append(nodes, top)
+	}
+
+	// Join neighbours at the same height.
+	s.nodes = nodes[:1]
+	for _, n := range nodes[1:] {
+		last := &s.nodes[len(s.nodes)-1]
+		if last.x == n.x {
+			last.w += n.w
+			continue
+		}
+		s.nodes = append(s.nodes, n)
+	}
+}
+
+// addWaste puts the gaps that the box is about to cover into the waste map.
+func (s *skyline) addWaste(b box) {
+	for _, n := range s.nodes {
+		lo, hi := n.y, n.y+n.w
+		if lo < b.y {
+			lo = b.y
+		}
+		if hi > b.y+b.w {
+			hi = b.y + b.w
+		}
+		if lo >= hi || n.x >= b.x {
+			continue
+		}
+		s.waste.free = append(s.waste.free, rect{x: n.x, y: lo, w: hi - lo, l: b.x - n.x})
+	}
+	s.waste.mergeFree()
+}
+
+// skylinePacker returns a Packer that uses the Skyline algorithm with the
+// given heuristic.
+func skylinePacker(h skylineHeuristic, wasteMap bool) Packer {
+	return PackerFunc(func(pal *pallet, boxes []box) []box {
+		return packWithSkylineHeuristic(pal, boxes, h, wasteMap)
+	})
+}
+
+// packWithSkyline fills a pallet with the Skyline algorithm, placing boxes
+// bottom-left and filling gaps from the waste map. It returns the boxes that
+// were not put onto the pallet.
+func packWithSkyline(pal *pallet, boxes []box) []box {
+	return packWithSkylineHeuristic(pal, boxes, skylineBL, true)
+}
+
+// packWithSkylineHeuristic fills a pallet by taking the boxes biggest first,
+// and placing each one that fits at its best spot. Gaps in the waste map are
+// filled before the skyline is raised.
+func packWithSkylineHeuristic(pal *pallet, boxes []box, h skylineHeuristic, wasteMap bool) []box {
+	s := newSkyline(pal.dims(), h, wasteMap)
+
+	sorted := make([]box, len(boxes))
+	copy(sorted, boxes)
+	sort.Stable(byArea(sorted))
+
+	unusedBoxes := make([]box, 0, len(boxes))
+	for _, b := range sorted {
+		if s.waste != nil {
+			if p, fi, _, ok := s.waste.find(b); ok {
+				if debug {
+					fmt.Printf("  + skyline(%s) waste box %v\n", h, p)
+				}
+				s.waste.place(p, fi)
+				pal.boxes = append(pal.boxes, p)
+				continue
+			}
+		}
+		p, _, _, ok := s.find(b)
+		if !ok {
+			unusedBoxes = append(unusedBoxes, b)
+			continue
+		}
+		if debug {
+			fmt.Printf("  + skyline(%s) box %v\n", h, p)
+		}
+		s.place(p)
+		pal.boxes = append(pal.boxes, p)
+	}
+	return unusedBoxes
+}
@@ -0,0 +1,63 @@
+package main
+
+import "testing"
+
+func Test_skyline_place(t *testing.T) {
+	s := newSkyline(palletSize{w: 4, l: 4}, skylineBL, true)
+	s.place(box{x: 0, y: 1, w: 2, l: 2, id: 90})
+	want := []skylineNode{{0, 0, 1}, {2, 1, 2}, {0, 3, 1}}
+	if len(s.nodes) != len(want) {
+		t.Fatalf("got %v, want %v", s.nodes, want)
+	}
+	for i := range want {
+		if s.nodes[i] != want[i] {
+			t.Errorf("%d: got %v, want %v", i, s.nodes[i], want[i])
+		}
+	}
+
+	// A box across all three nodes covers two gaps, which go to the
+	// waste map.
+	s.place(box{x: 2, y: 0, w: 4, l: 1, id: 91})
+	if want := (skylineNode{3, 0, 4}); len(s.nodes) != 1 || s.nodes[0] != want {
+		t.Errorf("got %v, want %v", s.nodes, want)
+	}
+	wantWaste := []rect{{0, 0, 1, 2}, {0, 3, 1, 2}}
+	if len(s.waste.free) != len(wantWaste) {
+		t.Fatalf("waste: got %v, want %v", s.waste.free, wantWaste)
+	}
+	for i := range wantWaste {
+		if s.waste.free[i] != wantWaste[i] {
+			t.Errorf("waste %d: got %v, want %v", i, s.waste.free[i], wantWaste[i])
+		}
+	}
+}
+
+func Test_skyline_fits(t *testing.T) {
+	s := newSkyline(palletSize{w: 4, l: 4}, skylineMinWaste, false)
+	s.nodes = []skylineNode{{2, 0, 1}, {1, 1, 1}, {0, 2, 2}}
+	x, waste, ok := s.fits(0, 3, 1)
+	if !ok || x != 2 || waste != 3 {
+		t.Errorf("got x %d, waste %d, ok %v, want 2, 3, true", x, waste, ok)
+	}
+	if _, _, ok := s.fits(1, 4, 1); ok {
+		t.Error("box past the edge fits")
+	}
+}
+
+func Test_packWithSkyline(t *testing.T) {
+	boxes := []box{
+		{x: 0, y: 0, w: 1, l: 1, id: 90},
+		{x: 0, y: 0, w: 1, l: 3, id: 91},
+		{x: 0, y: 0, w: 3, l: 3, id: 92},
+		{x: 0, y: 0, w: 4, l: 1, id: 93},
+		{x: 0, y: 0, w: 2, l: 2, id: 94},
+	}
+	pal := &pallet{}
+	unused := packWithSkyline(pal, boxes)
+	if err := pal.IsValid(); err != nil {
+		t.Fatalf("pallet is not packed correctly: %s", err)
+	}
+	if len(unused) != 2 {
+		t.Errorf("got %d unused boxes, want 2%s", len(unused), pal)
+	}
+}
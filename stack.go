@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// stacked returns a Packer that fills the deck of a pallet with p, and then
+// stacks the boxes that are left in layers on top of it.
+func stacked(p Packer) Packer {
+	return PackerFunc(func(pal *pallet, boxes []box) []box {
+		return packStacked(p, pal, boxes)
+	})
+}
+
+// packStacked fills the deck of a pallet with p, which only knows about one
+// layer, and then stacks the boxes it didn't use on top. Boxes taller than
+// the pallet are never used. It returns the boxes that were not put onto the
+// pallet.
+func packStacked(p Packer, pal *pallet, boxes []box) []box {
+	size := pal.dims()
+	fit := make([]box, 0, len(boxes))
+	tooTall := make([]box, 0)
+	for _, b := range boxes {
+		b.z = 0
+		if b.height() > size.height() {
+			tooTall = append(tooTall, b)
+			continue
+		}
+		fit = append(fit, b)
+	}
+
+	unusedBoxes := p.Pack(pal, fit)
+	if size.height() > 1 {
+		unusedBoxes = stackLayers(pal, unusedBoxes)
+	}
+	return append(unusedBoxes, tooTall...)
+}
+
+// stackLayers puts boxes on top of the ones already on the pallet, one layer
+// at a time from the bottom, biggest first. The space on each layer is found
+// by blocking out every cube that is taken, or that has nothing (or a fragile
+// box) under it, and keeping the maximal free rectangles around them. It
+// returns the boxes that were not put onto the pallet.
+func stackLayers(pal *pallet, boxes []box) []box {
+	size := pal.dims()
+	left := make([]box, len(boxes))
+	copy(left, boxes)
+	sort.Stable(byArea(left))
+
+	for k := 1; k < size.height() && len(left) > 0; k++ {
+		g, _ := pal.paint()
+		m := newMaxRects(size, maxRectsBSSF)
+		for i := 0; i < int(size.w); i++ {
+			for j := 0; j < int(size.l); j++ {
+				below := g.atz(i, j, k-1)
+				if g.atz(i, j, k) != emptybox || below == emptybox || below.fragile {
+					m.place(box{x: uint8(i), y: uint8(j), w: 1, l: 1})
+				}
+			}
+		}
+
+		unusedBoxes := make([]box, 0, len(left))
+		for _, b := range left {
+			if b.height() > size.height()-k {
+				unusedBoxes = append(unusedBoxes, b)
+				continue
+			}
+			p, _, _, ok := m.find(b)
+			if !ok {
+				unusedBoxes = append(unusedBoxes, b)
+				continue
+			}
+			p.z = uint8(k)
+			if debug {
+				fmt.Printf("  + stacked box %v on layer %d\n", p, k)
+			}
+			m.place(p)
+			pal.boxes = append(pal.boxes, p)
+		}
+		left = unusedBoxes
+	}
+	return left
+}
@@ -0,0 +1,54 @@
+package main
+
+import "testing"
+
+func Test_packStacked(t *testing.T) {
+	size := palletSize{w: 2, l: 2, h: 2}
+	var boxes []box
+	for i := 0; i < 9; i++ {
+		boxes = append(boxes, box{w: 1, l: 1, id: uint32(90 + i)})
+	}
+	pal := newPallet(size)
+	unused := packStacked(PackerFunc(packWithMaxRects), pal, boxes)
+	if err := pal.IsValid(); err != nil {
+		t.Fatal(err, pal)
+	}
+	if len(pal.boxes) != 8 || len(unused) != 1 {
+		t.Errorf("packed %d boxes with %d left, want 8 and 1%s", len(pal.boxes), len(unused), pal)
+	}
+
+	// Too tall for the pallet, or with nothing to rest on.
+	pal = newPallet(size)
+	unused = packStacked(PackerFunc(packWithMaxRects), pal, []box{
+		{w: 2, l: 2, h: 3, id: 90},
+		{w: 1, l: 2, id: 91},
+		{w: 2, l: 2, id: 92},
+	})
+	if err := pal.IsValid(); err != nil {
+		t.Fatal(err, pal)
+	}
+	if len(pal.boxes) != 2 || len(unused) != 1 || unused[0].id != 90 {
+		t.Errorf("packed %v, left %v%s", pal.boxes, unused, pal)
+	}
+}
+
+func Test_stackLayers(t *testing.T) {
+	// A tall box on one side of the deck leaves room on its top, and on
+	// the flat box beside it.
+	pal := newPallet(palletSize{w: 2, l: 4, h: 3})
+	pal.boxes = []box{
+		{x: 0, y: 0, w: 2, l: 2, h: 2, id: 90},
+		{x: 0, y: 2, w: 2, l: 2, id: 91},
+	}
+	unused := stackLayers(pal, []box{
+		{w: 2, l: 2, id: 92},
+		{w: 2, l: 2, id: 93},
+		{w: 4, l: 2, id: 94},
+	})
+	if err := pal.IsValid(); err != nil {
+		t.Fatal(err, pal)
+	}
+	if len(unused) != 1 {
+		t.Errorf("left %v, want one box%s", unused, pal)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// maxTruckSearchPasses limits the improvement phase of the truck optimizer,
+// so that a truck can't take forever even when there's time left.
+const maxTruckSearchPasses = 200
+
+// truckLoad is the set of boxes chosen for one pallet, before they're given
+// positions. Its area is the volume of the boxes, which is the same thing on
+// a pallet that is one layer tall.
+type truckLoad struct {
+	boxes []box
+	area  int
+}
+
+// truckOptimizer splits boxes across a truck's pallets, trying to ship as
+// many boxes as possible, and then as much box area. It starts from
+// first-fit-decreasing by area (or from filling one pallet at a time, if
+// that does better), then tries to improve the result by swapping
+// shipped boxes for ones that were left behind.
+//
+// Whether a set of boxes fits on one pallet is decided by the packer, so an
+// exact packer gives the best result.
+type truckOptimizer struct {
+	packer   Packer
+	size     palletSize
+	deadline time.Time
+	loads    []truckLoad
+	left     []box
+}
+
+// newTruckOptimizer prepares to fill n pallets of the given size.
+func newTruckOptimizer(p Packer, size palletSize, n int, deadline time.Time) *truckOptimizer {
+	return &truckOptimizer{
+		packer:   p,
+		size:     size,
+		deadline: deadline,
+		loads:    make([]truckLoad, n),
+	}
+}
+
+// fits returns true if all of the boxes go on one pallet.
+func (o *truckOptimizer) fits(boxes []box) bool {
+	area := 0
+	for _, b := range boxes {
+		area += b.volume()
+	}
+	if area > o.size.volume() {
+		return false
+	}
+	in := make([]box, len(boxes))
+	copy(in, boxes)
+	pal := newPallet(o.size)
+	return len(o.packer.Pack(pal, in)) == 0
+}
+
+// firstFit puts each box, biggest first, on the first pallet it fits on.
+// Boxes that fit nowhere are left behind.
+func (o *truckOptimizer) firstFit(boxes []box) {
+	sorted := make([]box, len(boxes))
+	copy(sorted, boxes)
+	sort.Stable(byArea(sorted))
+
+	o.firstFitOrder(sorted)
+}
+
+// firstFitOrder puts each box, in the order given, on the first pallet it
+// fits on. Boxes that fit nowhere are left behind, and so are the rest once
+// time runs out.
+func (o *truckOptimizer) firstFitOrder(boxes []box) {
+	for i, b := range boxes {
+		if time.Now().After(o.deadline) {
+			o.left = append(o.left, boxes[i:]...)
+			return
+		}
+		if !o.insert(b) {
+			o.left = append(o.left, b)
+		}
+	}
+}
+
+// fillEach fills one pallet at a time with the packer, the way the warehouse
+// does without the optimizer. Once time runs out, the rest of the pallets
+// stay empty.
+func (o *truckOptimizer) fillEach(boxes []box) {
+	left := make([]box, len(boxes))
+	copy(left, boxes)
+	for i := range o.loads {
+		if time.Now().After(o.deadline) {
+			break
+		}
+		pal := newPallet(o.size)
+		left = o.packer.Pack(pal, left)
+		ld := &o.loads[i]
+		for _, b := range pal.boxes {
+			ld.boxes = append(ld.boxes, b)
+			ld.area += b.volume()
+		}
+	}
+	o.left = left
+}
+
+// shipped is the area of all the boxes on the pallets.
+func (o *truckOptimizer) shipped() (area int) {
+	for _, ld := range o.loads {
+		area += ld.area
+	}
+	return
+}
+
+// score is what the optimizer tries to make as large as possible: the
+// number of boxes on the pallets, with their area breaking ties.
+func (o *truckOptimizer) score() int {
+	count := 0
+	for _, ld := range o.loads {
+		count += len(ld.boxes)
+	}
+	return count*(len(o.loads)*o.size.volume()+1) + o.shipped()
+}
+
+// insert adds the box to the first pallet it fits on.
+func (o *truckOptimizer) insert(b box) bool {
+	a := b.volume()
+	for i := range o.loads {
+		ld := &o.loads[i]
+		if ld.area+a > o.size.volume() {
+			continue
+		}
+		if o.fits(append(ld.boxes[:len(ld.boxes):len(ld.boxes)], b)) {
+			ld.boxes = append(ld.boxes, b)
+			ld.area += a
+			return true
+		}
+	}
+	return false
+}
+
+// improve takes a box off a pallet and refills the space with boxes that
+// were left behind, whenever that ships more boxes, or as many with more
+// area. The box taken off then gets
+// another chance to go anywhere it fits. It stops when a pass finds nothing
+// better, or time runs out.
+func (o *truckOptimizer) improve() {
+	for pass := 0; pass < maxTruckSearchPasses; pass++ {
+		if time.Now().After(o.deadline) || len(o.left) == 0 {
+			return
+		}
+		if !o.improveOnce() {
+			return
+		}
+	}
+}
+
+// improveOnce makes the first improving move it finds.
+func (o *truckOptimizer) improveOnce() bool {
+	sort.Stable(byArea(o.left))
+	for i := range o.loads {
+		ld := &o.loads[i]
+		for bi := range ld.boxes {
+			if time.Now().After(o.deadline) {
+				return false
+			}
+			kept := make([]box, 0, len(ld.boxes))
+			kept = append(kept, ld.boxes[:bi]...)
+			kept = append(kept, ld.boxes[bi+1:]...)
+			removed := ld.boxes[bi]
+
+			refilled, area, used := o.refill(kept, ld.area-removed.volume())
+			if len(refilled) < len(ld.boxes) || len(refilled) == len(ld.boxes) && area <= ld.area {
+				continue
+			}
+			if debug {
+				fmt.Printf("  truck optimizer: pallet %d swaps box %d for %d boxes\n", i, removed.id, len(used))
+			}
+			ld.boxes, ld.area = refilled, area
+			left := o.left[:0]
+			for li, b := range o.left {
+				if !used[li] {
+					left = append(left, b)
+				}
+			}
+			o.left = left
+			if !o.insert(removed) {
+				o.left = append(o.left, removed)
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// refill adds boxes that were left behind to a pallet's boxes, biggest
+// first, while they fit. It returns the new boxes, their area and which of
+// the boxes left behind were used. Boxes of the same size are
+// interchangeable, so once one doesn't fit the rest of that size are
+// skipped.
+func (o *truckOptimizer) refill(boxes []box, area int) ([]box, int, map[int]bool) {
+	used := make(map[int]bool)
+	failed := make(map[box]bool)
+	for li, b := range o.left {
+		a := b.volume()
+		key := b.canon()
+		key.id = 0
+		if area+a > o.size.volume() || failed[key] {
+			continue
+		}
+		if !o.fits(append(boxes[:len(boxes):len(boxes)], b)) {
+			failed[key] = true
+			continue
+		}
+		boxes = append(boxes, b)
+		area += a
+		used[li] = true
+	}
+	return boxes, area, used
+}
+
+// pallets packs each load that covers at least fill cells onto a pallet.
+// The boxes of the other loads are left behind.
+func (o *truckOptimizer) pallets(fill int) []*pallet {
+	out := make([]*pallet, 0, len(o.loads))
+	for _, ld := range o.loads {
+		if len(ld.boxes) == 0 || ld.area < fill {
+			o.left = append(o.left, ld.boxes...)
+			continue
+		}
+		pal := newPallet(o.size)
+		// The load was checked with the same packer, so nothing should be
+		// left over, but never lose a box.
+		o.left = append(o.left, o.packer.Pack(pal, ld.boxes)...)
+		out = append(out, pal)
+	}
+	return out
+}
+
+// Simulated annealing settings for search. A box counts for more than all
+// the cells of the truck, so losing a box is never accepted, but at the
+// starting temperature losing a cell or two of area often is.
+const (
+	annealStartTemp = 2.0
+	annealCooling   = 0.99
+	annealMinTemp   = 0.05
+)
+
+// search keeps trying new box orders with first fit until the deadline,
+// and returns the optimizer with the best score. Orders are changed by
+// simulated annealing, swapping two boxes at a time, and it restarts from a
+// shuffled biggest-first order whenever it cools down.
+func (o *truckOptimizer) search(boxes []box, rng *rand.Rand) *truckOptimizer {
+	best := o
+	if len(boxes) < 2 {
+		return best
+	}
+	order := make([]box, len(boxes))
+	for restarts := 0; time.Now().Before(o.deadline); restarts++ {
+		copy(order, boxes)
+		if restarts > 0 {
+			shuffleBySize(order, rng)
+		} else {
+			sort.Stable(byArea(order))
+		}
+		cur := o.decode(order)
+		if debug {
+			fmt.Printf("  truck optimizer: restart %d ships %d boxes\n", restarts, len(order)-len(cur.left))
+		}
+
+		for temp := annealStartTemp; temp > annealMinTemp && time.Now().Before(o.deadline); temp *= annealCooling {
+			if cur.score() > best.score() {
+				best = cur
+			}
+			if len(best.left) == 0 {
+				return best
+			}
+
+			// Only the boxes near the front are likely to ship, so
+			// swap one of those with any other box.
+			front := len(o.loads) * o.size.volume()
+			if front > len(order) {
+				front = len(order)
+			}
+			i, j := rng.Intn(front), rng.Intn(len(order))
+			order[i], order[j] = order[j], order[i]
+
+			next := o.decode(order)
+			delta := float64(next.score() - cur.score())
+			if delta >= 0 || rng.Float64() < math.Exp(delta/temp) {
+				cur = next
+			} else {
+				order[i], order[j] = order[j], order[i]
+			}
+		}
+		if cur.score() > best.score() {
+			best = cur
+		}
+	}
+	return best
+}
+
+// decode fills empty pallets with the boxes in order.
+func (o *truckOptimizer) decode(order []box) *truckOptimizer {
+	d := newTruckOptimizer(o.packer, o.size, len(o.loads), o.deadline)
+	d.firstFitOrder(order)
+	return d
+}
+
+// shuffleBySize orders the boxes roughly biggest first, with some noise so
+// that each call gives a different order.
+func shuffleBySize(boxes []box, rng *rand.Rand) {
+	n := noisyBoxes{boxes: boxes, keys: make([]float64, len(boxes))}
+	for i, b := range boxes {
+		n.keys[i] = float64(b.volume()) + 4*rng.Float64()
+	}
+	sort.Stable(n)
+}
+
+// noisyBoxes sorts boxes by their keys, biggest first.
+type noisyBoxes struct {
+	boxes []box
+	keys  []float64
+}
+
+func (n noisyBoxes) Len() int           { return len(n.boxes) }
+func (n noisyBoxes) Less(i, j int) bool { return n.keys[i] > n.keys[j] }
+func (n noisyBoxes) Swap(i, j int) {
+	n.boxes[i], n.boxes[j] = n.boxes[j], n.boxes[i]
+	n.keys[i], n.keys[j] = n.keys[j], n.keys[i]
+}
+
+// optimizeTruck splits the boxes across n pallets of the given size. A greedy answer is found
+// right away, and then searched for something better until the deadline.
+// Pallets that cover fewer than fill cells are not used. It returns the
+// packed pallets and the boxes that didn't make it onto any of them.
+func optimizeTruck(p Packer, size palletSize, boxes []box, n, fill int, deadline time.Time, rng *rand.Rand) ([]*pallet, []box) {
+	// Start from whichever of first fit and one pallet at a time does
+	// better.
+	o := newTruckOptimizer(p, size, n, deadline)
+	o.firstFit(boxes)
+	each := newTruckOptimizer(p, size, n, deadline)
+	each.fillEach(boxes)
+	if each.score() > o.score() {
+		o = each
+	}
+	o.improve()
+	o = o.search(boxes, rng)
+	pallets := o.pallets(fill)
+	return pallets, o.left
+}
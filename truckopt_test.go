@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+func Test_optimizeTruck(t *testing.T) {
+	// First fit puts a 3x3 on each pallet, which leaves no room for the
+	// 2x2s. Swapping one 3x3 for all four 2x2s ships more.
+	boxes := []box{
+		{x: 0, y: 0, w: 2, l: 2, id: 90},
+		{x: 0, y: 0, w: 2, l: 2, id: 91},
+		{x: 0, y: 0, w: 2, l: 2, id: 92},
+		{x: 0, y: 0, w: 2, l: 2, id: 93},
+		{x: 0, y: 0, w: 3, l: 3, id: 94},
+		{x: 0, y: 0, w: 3, l: 3, id: 95},
+		{x: 0, y: 0, w: 1, l: 1, id: 96},
+	}
+	deadline := time.Now().Add(50 * time.Millisecond)
+	pallets, unused := optimizeTruck(PackerFunc(packExact), palletSize{w: 4, l: 4}, boxes, 2, 1, deadline, rand.New(rand.NewSource(1)))
+	if len(pallets) != 2 {
+		t.Fatalf("got %d pallets, want 2", len(pallets))
+	}
+	shipped := 0
+	for _, p := range pallets {
+		if err := p.IsValid(); err != nil {
+			t.Errorf("pallet is not packed correctly: %s%s", err, p)
+		}
+		for _, b := range p.boxes {
+			shipped += int(b.w) * int(b.l)
+		}
+	}
+	if got, want := shipped, 4*4+9+1; got != want {
+		t.Errorf("shipped %d cells, want %d", got, want)
+	}
+	if got, want := len(unused), 1; got != want {
+		t.Errorf("got %d unused boxes, want %d", got, want)
+	}
+
+	// Only the full pallet ships when partial ones are held back.
+	deadline = time.Now().Add(50 * time.Millisecond)
+	pallets, unused = optimizeTruck(PackerFunc(packExact), palletSize{w: 4, l: 4}, boxes, 2, 16, deadline, rand.New(rand.NewSource(1)))
+	if len(pallets) != 1 || len(unused) != 3 {
+		t.Errorf("got %d pallets and %d unused boxes, want 1 and 3", len(pallets), len(unused))
+	}
+
+	// Out of time, nothing is packed and every box is left.
+	pallets, unused = optimizeTruck(PackerFunc(packExact), palletSize{w: 4, l: 4}, boxes, 2, 1, time.Now(), rand.New(rand.NewSource(1)))
+	if len(pallets) != 0 || len(unused) != len(boxes) {
+		t.Errorf("out of time, got %d pallets and %d unused boxes", len(pallets), len(unused))
+	}
+}
+
+func Test_optimizeTruck_count(t *testing.T) {
+	// Two small boxes ship before one that fills the pallet.
+	boxes := []box{
+		{x: 0, y: 0, w: 4, l: 4, id: 90},
+		{x: 0, y: 0, w: 1, l: 1, id: 91},
+		{x: 0, y: 0, w: 1, l: 1, id: 92},
+	}
+	deadline := time.Now().Add(50 * time.Millisecond)
+	pallets, unused := optimizeTruck(PackerFunc(packExact), palletSize{w: 4, l: 4}, boxes, 1, 1, deadline, rand.New(rand.NewSource(1)))
+	if len(pallets) != 1 || len(unused) != 1 || unused[0].id != 90 {
+		t.Fatalf("got %d pallets and unused %v, want 1 pallet and box 90 unused", len(pallets), unused)
+	}
+}
+
+func Test_truckOptimizer_improve(t *testing.T) {
+	o := newTruckOptimizer(PackerFunc(packExact), palletSize{w: 4, l: 4}, 1, time.Now().Add(time.Second))
+	o.loads[0] = truckLoad{boxes: []box{{x: 0, y: 0, w: 1, l: 1, id: 90}, {x: 0, y: 0, w: 1, l: 1, id: 91}}, area: 2}
+	o.left = []box{{x: 0, y: 0, w: 4, l: 3, id: 92}}
+	o.improve()
+	if got, want := o.loads[0].area, 14; got != want {
+		t.Errorf("got area %d, want %d: %v", got, want, o.loads[0].boxes)
+	}
+	if len(o.left) != 0 {
+		t.Errorf("got %d boxes left, want 0", len(o.left))
+	}
+}
+
+func Test_truckOptimizer_search(t *testing.T) {
+	// Biggest first puts 3x2s on the pallet before the 2x2s, which
+	// strands space. The only full pallet is four 2x2s.
+	boxes := []box{
+		{x: 0, y: 0, w: 3, l: 2, id: 90},
+		{x: 0, y: 0, w: 3, l: 2, id: 91},
+		{x: 0, y: 0, w: 2, l: 2, id: 92},
+		{x: 0, y: 0, w: 2, l: 2, id: 93},
+		{x: 0, y: 0, w: 2, l: 2, id: 94},
+		{x: 0, y: 0, w: 2, l: 2, id: 95},
+	}
+	o := newTruckOptimizer(PackerFunc(packWithMaxRects), palletSize{w: 4, l: 4}, 1, time.Now().Add(time.Second))
+	o.firstFit(boxes)
+	if o.shipped() == 16 {
+		t.Fatal("first fit already ships a full pallet")
+	}
+	best := o.search(boxes, rand.New(rand.NewSource(1)))
+	if got, want := best.shipped(), 16; got != want {
+		t.Errorf("search ships %d, want %d: %v", got, want, best.loads[0].boxes)
+	}
+}
+
+func Test_warehouse_truckDeadline(t *testing.T) {
+	now := time.Now()
+	w := &warehouse{
+		trucks:    make(chan truck, 10),
+		doneTime:  now.Add(time.Second),
+		finalTime: now.Add(2 * time.Second),
+		unpacked:  make(chan struct{}),
+	}
+	// While trucks are arriving, the waiting trucks share the time until
+	// doneTime.
+	w.trucks <- truck{}
+	if d := w.truckDeadline(); d.After(now.Add(time.Second * 6 / 10)) {
+		t.Errorf("truck deadline %v with one truck waiting", d.Sub(now))
+	}
+	// Once they're in, they share the time until the last deadline.
+	close(w.unpacked)
+	if d := w.truckDeadline(); d.Before(now.Add(time.Second/2)) || d.After(w.lastDeadline()) {
+		t.Errorf("truck deadline %v with all trucks in", d.Sub(now))
+	}
+	if d := w.lastDeadline(); d.After(w.finalTime) {
+		t.Errorf("last deadline %v is after the final time", d.Sub(now))
+	}
+	w = &warehouse{}
+	if d := w.truckDeadline(); d.After(time.Now()) {
+		t.Error("warehouse without times has time to search")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// A manifestCheck is what validating a manifest found.
+type manifestCheck struct {
+	trucks, pallets, boxes int
+	problems               []string
+}
+
+func (c *manifestCheck) problemf(format string, args ...interface{}) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
+
+// checkManifest reads every truck from src and checks it, without
+// repacking anything. Every inbound pallet must be correctly packed, box and
+// truck ids must be unique, no truck may use the id of the last truck, and
+// no truck may be empty. Trucks a lenient source skipped are problems too.
+func checkManifest(src truckSource) *manifestCheck {
+	c := &manifestCheck{}
+	trucks := make(map[int]bool)
+	boxes := make(map[uint32]int)
+	for {
+		t, err := src.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			c.problemf("reading trucks: %v", err)
+			break
+		}
+		c.trucks++
+
+		if t.id == idLastTruck {
+			c.problemf("truck %d: id %d is kept for the last truck", t.id, idLastTruck)
+		}
+		if trucks[t.id] {
+			c.problemf("truck %d: more than one truck has this id", t.id)
+		}
+		trucks[t.id] = true
+		if len(t.pallets) == 0 {
+			c.problemf("truck %d: no pallets", t.id)
+		}
+
+		for pn, p := range t.pallets {
+			c.pallets++
+			if err := p.IsValid(); err != nil {
+				c.problemf("truck %d pallet %d: %v", t.id, pn, err)
+			}
+			for _, b := range p.boxes {
+				c.boxes++
+				if first, ok := boxes[b.id]; ok {
+					c.problemf("truck %d pallet %d: box %d is also in truck %d", t.id, pn, b.id, first)
+					continue
+				}
+				boxes[b.id] = t.id
+			}
+		}
+	}
+	if s, ok := src.(skippingSource); ok {
+		for _, e := range s.Skipped() {
+			c.problemf("%v", e)
+		}
+	}
+	return c
+}
+
+// write writes what was found, ending with a summary.
+func (c *manifestCheck) write(w io.Writer) error {
+	var b strings.Builder
+	for _, p := range c.problems {
+		fmt.Fprintln(&b, p)
+	}
+	fmt.Fprintf(&b, "%d trucks, %d pallets, %d boxes: %d problems\n", c.trucks, c.pallets, c.boxes, len(c.problems))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// validateMain runs the validate subcommand, which checks the trucks in a
+// manifest file. It returns whether the manifest is good.
+func validateMain(args []string) (bool, error) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	format := fs.String("format", formatAuto, "The format of the manifest: "+strings.Join(formats, ", ")+".")
+	palletDims := fs.String("pallet", defaultPalletSize.String(), "The size of pallets that the manifest doesn't give a size for.")
+	maxWeight := fs.Uint("maxweight", 0, "The most the boxes on each pallet may weigh, or 0 for no limit.")
+	rulesFile := fs.String("rules", "", "A file of rules for which boxes can't share a pallet (optional).")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s validate [flags] manifest\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	size, err := palletSizeFromString(*palletDims)
+	if err != nil {
+		return false, err
+	}
+	size.maxWeight = uint32(*maxWeight)
+	defaultPalletSize = size
+	if *rulesFile != "" {
+		rs, err := loadRules(*rulesFile)
+		if err != nil {
+			return false, err
+		}
+		palletRules = rs
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	// Carry on past trucks that can't be read, so that everything wrong is
+	// reported at once.
+	lenientParsing = true
+	src, err := newTruckSource(f, *format)
+	if err != nil {
+		return false, err
+	}
+	c := checkManifest(src)
+	if err := c.write(os.Stdout); err != nil {
+		return false, err
+	}
+	return len(c.problems) == 0, nil
+}
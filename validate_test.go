@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func Test_checkManifest(t *testing.T) {
+	in := `truck 1
+0 0 1 1 101,1 0 1 1 102
+endtruck
+truck 2
+0 0 2 2 103,1 1 1 1 104
+0 0 1 1 101
+endtruck
+truck 1
+0 0 1 1 105
+endtruck
+truck 0
+0 0 1 1 106
+endtruck
+truck 3
+endtruck
+truck 4
+0 0 1 1
+endtruck
+`
+	r := newTruckReader(strings.NewReader(in))
+	r.lenient = true
+	c := checkManifest(r)
+
+	want := []string{
+		"truck 2 pallet 0: box 1 overlaps others",
+		"truck 2 pallet 1: box 101 is also in truck 1",
+		"truck 1: more than one truck has this id",
+		"truck 0: id 0 is kept for the last truck",
+		"truck 3: no pallets",
+		"line 17, column 1 (truck 4): box needs x, y, w, l and id",
+	}
+	if len(c.problems) != len(want) {
+		t.Fatalf("problems %q", c.problems)
+	}
+	for i, w := range want {
+		if c.problems[i] != w {
+			t.Errorf("problem %d is %q, want %q", i, c.problems[i], w)
+		}
+	}
+	if c.trucks != 5 || c.pallets != 5 || c.boxes != 7 {
+		t.Errorf("%d trucks, %d pallets, %d boxes", c.trucks, c.pallets, c.boxes)
+	}
+
+	var buf bytes.Buffer
+	if err := c.write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(buf.String(), "5 trucks, 5 pallets, 7 boxes: 6 problems\n") {
+		t.Errorf("report ends %q", buf.String())
+	}
+}
+
+func Test_checkManifest_good(t *testing.T) {
+	in := `truck 1
+0 0 1 1 101,1 1 1 1 102,3 0 4 1 104
+endtruck
+truck 2 pallet=4x6x2 maxweight=50
+0 0 2 3 106 12 lock=1 fragile=1,3 0 1 1 107 h=2
+endtruck
+`
+	c := checkManifest(newTruckReader(strings.NewReader(in)))
+	if len(c.problems) != 0 {
+		t.Errorf("problems %q", c.problems)
+	}
+}
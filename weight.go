@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"sort"
+)
+
+// underWeight returns a Packer that fills a pallet with p, without going
+// over its weight limit.
+func underWeight(p Packer) Packer {
+	return PackerFunc(func(pal *pallet, boxes []box) []box {
+		return packUnderWeight(p, pal, boxes)
+	})
+}
+
+// packUnderWeight fills a pallet with p, which doesn't know about weight.
+// If the pallet comes out too heavy, the heaviest boxes on it are set aside
+// until the rest are under the limit, and the pallet is packed once more
+// with the rest, and as many of the lightest boxes that didn't fit as stay
+// under the limit. It returns the boxes that were not put onto the pallet.
+func packUnderWeight(p Packer, pal *pallet, boxes []box) []box {
+	limit := int(pal.dims().maxWeight)
+	if limit == 0 {
+		return p.Pack(pal, boxes)
+	}
+
+	start := len(pal.boxes)
+	base := pal.Weight()
+	in := make([]box, 0, len(boxes))
+	setAside := make([]box, 0)
+	for _, b := range boxes {
+		if base+int(b.weight) > limit {
+			setAside = append(setAside, b)
+			continue
+		}
+		in = append(in, b)
+	}
+
+	try := make([]box, len(in))
+	copy(try, in)
+	unusedBoxes := p.Pack(pal, try)
+	if pal.Weight() <= limit {
+		return append(unusedBoxes, setAside...)
+	}
+
+	// Go back to the boxes as they were given, heaviest first.
+	packed := make(map[uint32]bool)
+	for _, b := range pal.boxes[start:] {
+		packed[b.id] = true
+	}
+	pal.boxes = pal.boxes[:start]
+	sort.SliceStable(in, func(i, j int) bool { return in[i].weight > in[j].weight })
+	weight := base
+	var kept, left []box
+	for _, b := range in {
+		if packed[b.id] {
+			kept = append(kept, b)
+			weight += int(b.weight)
+		} else {
+			left = append(left, b)
+		}
+	}
+	// The boxes already on the pallet may be too heavy on their own, and
+	// then every box is set aside.
+	for weight > limit && len(kept) > 0 {
+		if debug {
+			log.Printf("  pallet weighs %d of %d, setting box %d aside\n", weight, limit, kept[0].id)
+		}
+		weight -= int(kept[0].weight)
+		setAside = append(setAside, kept[0])
+		kept = kept[1:]
+	}
+	for i := len(left) - 1; i >= 0; i-- {
+		if b := left[i]; weight+int(b.weight) <= limit {
+			kept = append(kept, b)
+			weight += int(b.weight)
+		} else {
+			setAside = append(setAside, b)
+		}
+	}
+	return append(p.Pack(pal, kept), setAside...)
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func Test_packUnderWeight(t *testing.T) {
+	pal := newPallet(palletSize{w: 4, l: 4, maxWeight: 10})
+	unused := packUnderWeight(PackerFunc(packWithMaxRects), pal, []box{
+		{w: 4, l: 2, id: 90, weight: 8},
+		{w: 2, l: 2, id: 91, weight: 3},
+		{w: 2, l: 2, id: 92, weight: 3},
+		{w: 1, l: 1, id: 93, weight: 11},
+	})
+	if err := pal.IsValid(); err != nil {
+		t.Fatal(err, pal)
+	}
+	// The big box is the worst for its weight, so the two small ones go
+	// and the pallet is half full.
+	if pal.Weight() != 6 || len(pal.boxes) != 2 || len(unused) != 2 {
+		t.Errorf("packed %v, left %v", pal.boxes, unused)
+	}
+}
+
+func Test_packUnderWeight_once(t *testing.T) {
+	// Every box fits, but only five of them are light enough. The pallet
+	// is packed again once, not once for each box set aside.
+	calls := 0
+	p := PackerFunc(func(pal *pallet, boxes []box) []box {
+		calls++
+		return packWithMaxRects(pal, boxes)
+	})
+	var boxes []box
+	for i := 0; i < 16; i++ {
+		boxes = append(boxes, box{w: 1, l: 1, id: uint32(90 + i), weight: uint32(1 + i%2)})
+	}
+	pal := newPallet(palletSize{w: 4, l: 4, maxWeight: 5})
+	unused := packUnderWeight(p, pal, boxes)
+	if err := pal.IsValid(); err != nil {
+		t.Fatal(err, pal)
+	}
+	if calls != 2 {
+		t.Errorf("packed %d times, want 2", calls)
+	}
+	if pal.Weight() != 5 || len(pal.boxes) != 5 || len(unused) != 11 {
+		t.Errorf("packed %v weighing %d, left %d boxes", pal.boxes, pal.Weight(), len(unused))
+	}
+}
+
+func Test_packUnderWeight_tooHeavy(t *testing.T) {
+	// The box already on the pallet is over the limit by itself, and so is
+	// the one to pack. Nothing can go on, and nothing panics.
+	pal := newPallet(palletSize{w: 4, l: 4, maxWeight: 5})
+	pal.boxes = append(pal.boxes, box{w: 1, l: 1, id: 90, weight: 6})
+	unused := packUnderWeight(PackerFunc(packWithMaxRects), pal, []box{
+		{w: 1, l: 1, id: 91, weight: 7},
+		{w: 1, l: 1, id: 92, weight: 1},
+	})
+	if len(pal.boxes) != 1 || pal.boxes[0].id != 90 || len(unused) != 2 {
+		t.Errorf("packed %v, left %v", pal.boxes, unused)
+	}
+}